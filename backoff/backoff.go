@@ -0,0 +1,45 @@
+package backoff
+
+import (
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Policy is how failed operations are retried, e.g.: handlings, before the
+// message is acknowledged, or dead-lettered, or publishes.
+type Policy struct {
+	// Backoff is the wait before each retry. Its length is the amount of
+	// retries.
+	Backoff []time.Duration `json:"backoff"`
+
+	// Jitter randomizes each wait by up to this factor, between 0, and 1,
+	// so retries of concurrent failures spread out.
+	Jitter float64 `json:"jitter,omitempty" validate:"gte=0,lte=1"`
+}
+
+//////
+// Factory.
+//////
+
+// Constant creates a retry policy retrying `retries` times, waiting `wait`
+// before each retry.
+func Constant(retries int, wait time.Duration) *Policy {
+	return &Policy{Backoff: retrier.ConstantBackoff(retries, wait)}
+}
+
+// Exponential creates a retry policy retrying `retries` times, waiting
+// `initial` before the first retry, then doubling the wait each retry.
+func Exponential(retries int, initial time.Duration) *Policy {
+	return &Policy{Backoff: retrier.ExponentialBackoff(retries, initial)}
+}
+
+// Jittered creates an exponential retry policy (see `Exponential`), which
+// waits are randomized by up to `jitter`, a factor between 0, and 1.
+func Jittered(retries int, initial time.Duration, jitter float64) *Policy {
+	return &Policy{Backoff: retrier.ExponentialBackoff(retries, initial), Jitter: jitter}
+}
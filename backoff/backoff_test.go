@@ -0,0 +1,40 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		want   []time.Duration
+		jitter float64
+	}{
+		{
+			name:   "Should work - constant",
+			policy: Constant(3, time.Second),
+			want:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:   "Should work - exponential",
+			policy: Exponential(3, time.Second),
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:   "Should work - jittered",
+			policy: Jittered(3, time.Second, 0.5),
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+			jitter: 0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Backoff)
+			assert.Equal(t, tt.jitter, tt.policy.Jitter)
+		})
+	}
+}
@@ -0,0 +1,4 @@
+// Package backoff provides the retry policies, constant, exponential, or
+// jittered, shared by the subscriptions, retrying failed handlings, and the
+// publishers, retrying failed publishes.
+package backoff
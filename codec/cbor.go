@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"reflect"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// CBORCodec is the CBOR codec. Like JSON, it honors the `json` struct tags.
+type CBORCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+// CBOR is the CBOR codec.
+var CBOR Codec = newCBOR()
+
+//////
+// Helpers.
+//////
+
+// newCBOR creates the CBOR codec.
+func newCBOR() *CBORCodec {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+
+	// Maps are decoded like JSON does.
+	dec, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any{})}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+
+	return &CBORCodec{enc: enc, dec: dec}
+}
+
+//////
+// Implements the Codec interface.
+//////
+
+// ContentType identifies the codec.
+func (c *CBORCodec) ContentType() string {
+	return "application/cbor"
+}
+
+// Marshal encodes `v`.
+func (c *CBORCodec) Marshal(v any) ([]byte, error) {
+	data, err := c.enc.Marshal(v)
+	if err != nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSharedMarshal).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return data, nil
+}
+
+// Unmarshal decodes `data` into `v`.
+func (c *CBORCodec) Unmarshal(data []byte, v any) error {
+	if err := c.dec.Unmarshal(data, v); err != nil {
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSharedUnmarshal).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return nil
+}
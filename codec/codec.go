@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"sync"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// ContentTypeHeader is the envelope header recording the codec used to encode
+// a message, so consumers decode it automatically. It's owned by the pubsub,
+// so it never conflicts with a `Content-Type` header set on the message.
+const ContentTypeHeader = "Pubsub-Content-Type"
+
+// Codec encodes, and decodes messages.
+type Codec interface {
+	// ContentType identifies the codec, e.g.: "application/json".
+	ContentType() string
+
+	// Marshal encodes `v`.
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes `data` into `v`.
+	Unmarshal(data []byte, v any) error
+}
+
+// Registry.
+var (
+	mu       sync.RWMutex
+	registry = map[string]Codec{}
+)
+
+// Default is the codec used when none is specified, or when decoding messages
+// without content type.
+var Default Codec = JSON
+
+//////
+// Built-in codecs.
+//////
+
+// JSONCodec is the compact JSON codec.
+type JSONCodec struct{}
+
+// ContentType identifies the codec.
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Marshal encodes `v`.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return shared.Marshal(v)
+}
+
+// Unmarshal decodes `data` into `v`.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return shared.Unmarshal(data, v)
+}
+
+// JSON is the compact JSON codec.
+var JSON Codec = JSONCodec{}
+
+//////
+// Exported functionalities.
+//////
+
+// Register makes `c` available to decode messages encoded with it. Registering
+// a codec with the content type of another, replaces it.
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	registry[c.ContentType()] = c
+}
+
+// Get returns the codec registered for `contentType`. An empty content type
+// returns the `Default` codec.
+func Get(contentType string) (Codec, error) {
+	if contentType == "" {
+		return Default, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := registry[contentType]
+	if !ok {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrCodecUnknown).
+			NewFailedToError(customerror.WithField("contentType", contentType))
+	}
+
+	return c, nil
+}
+
+func init() {
+	Register(JSON)
+	Register(MessagePack)
+	Register(CBOR)
+	Register(Protobuf)
+}
@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+		data  any
+		want  any
+	}{
+		{
+			name:  "Should work - JSON",
+			codec: JSON,
+			data:  map[string]any{"name": "test", "version": 1},
+			want:  map[string]any{"name": "test", "version": float64(1)},
+		},
+		{
+			name:  "Should work - MessagePack",
+			codec: MessagePack,
+			data:  map[string]any{"name": "test", "version": 1},
+			want:  map[string]any{"name": "test", "version": int64(1)},
+		},
+		{
+			name:  "Should work - CBOR",
+			codec: CBOR,
+			data:  map[string]any{"name": "test", "version": 1},
+			want:  map[string]any{"name": "test", "version": uint64(1)},
+		},
+		{
+			name:  "Should work - Protobuf",
+			codec: Protobuf,
+			data:  wrapperspb.String("test"),
+			want:  wrapperspb.String("test"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := message.MustNew("v1.meta.created", tt.data)
+
+			// Registered, so consumers find it.
+			c, err := Get(tt.codec.ContentType())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.codec, c)
+
+			b, err := c.Marshal(msg)
+			assert.NoError(t, err)
+
+			var got message.Message
+
+			assert.NoError(t, c.Unmarshal(b, &got))
+
+			assert.Equal(t, msg.ID, got.ID)
+			assert.Equal(t, msg.Topic, got.Topic)
+			assert.Equal(t, msg.Status, got.Status)
+			assert.True(t, msg.CreatedAt.Equal(got.CreatedAt))
+
+			if want, ok := tt.want.(proto.Message); ok {
+				assert.True(t, proto.Equal(want, got.Data.(proto.Message)))
+			} else {
+				assert.Equal(t, tt.want, got.Data)
+			}
+		})
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	// Data must be a protobuf message.
+	_, err := Protobuf.Marshal(message.MustNew("v1.meta.created", "test"))
+	assert.Error(t, err)
+
+	// Unknown data types are kept as `Any`.
+	a, err := anypb.New(wrapperspb.String("test"))
+	assert.NoError(t, err)
+
+	a.TypeUrl = "type.googleapis.com/unknown.Type"
+
+	msg := message.MustNew("v1.meta.created", nil)
+	msg.CreatedAt = time.Time{}
+
+	b, err := Protobuf.Marshal(msg)
+	assert.NoError(t, err)
+
+	b = append(b, 0x5a) // Field 11, bytes.
+
+	raw, err := proto.Marshal(a)
+	assert.NoError(t, err)
+
+	b = append(b, byte(len(raw)))
+	b = append(b, raw...)
+
+	var got message.Message
+
+	assert.NoError(t, Protobuf.Unmarshal(b, &got))
+	assert.IsType(t, &anypb.Any{}, got.Data)
+	assert.True(t, got.CreatedAt.IsZero())
+}
+
+func TestGet(t *testing.T) {
+	// No content type, default codec.
+	c, err := Get("")
+	assert.NoError(t, err)
+	assert.Equal(t, Default, c)
+
+	// Unknown content type.
+	_, err = Get("application/unknown")
+	assert.Error(t, err)
+}
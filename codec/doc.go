@@ -0,0 +1,3 @@
+// Package codec provides how messages are encoded, and decoded when
+// transported: compact JSON, MessagePack, CBOR, and Protobuf.
+package codec
@@ -0,0 +1,64 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/thalesfsp/customerror"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// MessagePackCodec is the MessagePack codec. Like JSON, it honors the `json`
+// struct tags.
+type MessagePackCodec struct{}
+
+// MessagePack is the MessagePack codec.
+var MessagePack Codec = MessagePackCodec{}
+
+//////
+// Implements the Codec interface.
+//////
+
+// ContentType identifies the codec.
+func (MessagePackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+// Marshal encodes `v`.
+func (MessagePackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+
+	if err := enc.Encode(v); err != nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSharedMarshal).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes `data` into `v`.
+func (MessagePackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	// Numbers are decoded as int64, uint64, or float64.
+	dec.UseLooseInterfaceDecoding(true)
+
+	if err := dec.Decode(v); err != nil {
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSharedUnmarshal).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package codec
+
+import (
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Message fields numbers. Messages are encoded as:
+//
+//	message Message {
+//	  string id = 1;
+//	  string topic = 2;
+//	  string queue = 3;
+//	  string status = 4;
+//	  google.protobuf.Timestamp created_at = 5;
+//	  string created_by = 6;
+//	  google.protobuf.Timestamp updated_at = 7;
+//	  string updated_by = 8;
+//	  google.protobuf.Timestamp delete_at = 9;
+//	  string delete_by = 10;
+//	  google.protobuf.Any data = 11;
+//	}
+const (
+	fieldID protowire.Number = iota + 1
+	fieldTopic
+	fieldQueue
+	fieldStatus
+	fieldCreatedAt
+	fieldCreatedBy
+	fieldUpdatedAt
+	fieldUpdatedBy
+	fieldDeleteAt
+	fieldDeleteBy
+	fieldData
+)
+
+// ProtobufCodec is the Protobuf codec. It encodes Protobuf messages. Messages
+// data must be Protobuf messages, which are decoded automatically if their
+// type is linked in the consumer binary, otherwise they are decoded as
+// `*anypb.Any`.
+type ProtobufCodec struct{}
+
+// Protobuf is the Protobuf codec.
+var Protobuf Codec = ProtobufCodec{}
+
+//////
+// Helpers.
+//////
+
+// appendString appends the string field `n`, if not empty.
+func appendString(b []byte, n protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, n, protowire.BytesType)
+
+	return protowire.AppendString(b, v)
+}
+
+// appendMessage appends the message field `n`.
+func appendMessage(b []byte, n protowire.Number, m proto.Message) ([]byte, error) {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	b = protowire.AppendTag(b, n, protowire.BytesType)
+
+	return protowire.AppendBytes(b, data), nil
+}
+
+// appendTime appends the time field `n`, if not zero.
+func appendTime(b []byte, n protowire.Number, t time.Time) ([]byte, error) {
+	if t.IsZero() {
+		return b, nil
+	}
+
+	return appendMessage(b, n, timestamppb.New(t))
+}
+
+// marshalMessage encodes `msg`.
+func marshalMessage(msg *message.Message) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	b = appendString(b, fieldID, msg.ID)
+	b = appendString(b, fieldTopic, msg.Topic)
+	b = appendString(b, fieldQueue, msg.Queue)
+	b = appendString(b, fieldStatus, msg.Status.String())
+	b = appendString(b, fieldCreatedBy, msg.CreatedBy)
+	b = appendString(b, fieldUpdatedBy, msg.UpdatedBy)
+	b = appendString(b, fieldDeleteBy, msg.DeleteBy)
+
+	if b, err = appendTime(b, fieldCreatedAt, msg.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if b, err = appendTime(b, fieldUpdatedAt, msg.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if b, err = appendTime(b, fieldDeleteAt, msg.DeleteAt); err != nil {
+		return nil, err
+	}
+
+	if msg.Data == nil {
+		return b, nil
+	}
+
+	data, ok := msg.Data.(proto.Message)
+	if !ok {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrCodecUnsupported).
+			NewFailedToError(
+				customerror.WithField("contentType", Protobuf.ContentType()),
+				customerror.WithField("reason", "data isn't a protobuf message"),
+			)
+	}
+
+	a, err := anypb.New(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendMessage(b, fieldData, a)
+}
+
+// unmarshalTime decodes a timestamp.
+func unmarshalTime(v []byte) (time.Time, error) {
+	var ts timestamppb.Timestamp
+
+	if err := proto.Unmarshal(v, &ts); err != nil {
+		return time.Time{}, err
+	}
+
+	return ts.AsTime(), nil
+}
+
+// unmarshalData decodes the data, into its type if known.
+func unmarshalData(v []byte) (any, error) {
+	var a anypb.Any
+
+	if err := proto.Unmarshal(v, &a); err != nil {
+		return nil, err
+	}
+
+	data, err := a.UnmarshalNew()
+	if err != nil {
+		// Unknown type.
+		return &a, nil //nolint:nilerr
+	}
+
+	return data, nil
+}
+
+// unmarshalMessage decodes `b` into `msg`.
+//
+//nolint:gocognit,gocyclo
+func unmarshalMessage(b []byte, msg *message.Message) error {
+	for len(b) > 0 {
+		n, t, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+
+		b = b[l:]
+
+		if t != protowire.BytesType {
+			l = protowire.ConsumeFieldValue(n, t, b)
+			if l < 0 {
+				return protowire.ParseError(l)
+			}
+
+			b = b[l:]
+
+			continue
+		}
+
+		v, l := protowire.ConsumeBytes(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+
+		b = b[l:]
+
+		var err error
+
+		switch n {
+		case fieldID:
+			msg.ID = string(v)
+		case fieldTopic:
+			msg.Topic = string(v)
+		case fieldQueue:
+			msg.Queue = string(v)
+		case fieldStatus:
+			msg.Status = status.Status(v)
+		case fieldCreatedBy:
+			msg.CreatedBy = string(v)
+		case fieldUpdatedBy:
+			msg.UpdatedBy = string(v)
+		case fieldDeleteBy:
+			msg.DeleteBy = string(v)
+		case fieldCreatedAt:
+			msg.CreatedAt, err = unmarshalTime(v)
+		case fieldUpdatedAt:
+			msg.UpdatedAt, err = unmarshalTime(v)
+		case fieldDeleteAt:
+			msg.DeleteAt, err = unmarshalTime(v)
+		case fieldData:
+			msg.Data, err = unmarshalData(v)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//////
+// Implements the Codec interface.
+//////
+
+// ContentType identifies the codec.
+func (ProtobufCodec) ContentType() string {
+	return "application/protobuf"
+}
+
+// Marshal encodes `v`, a `*message.Message`, or a Protobuf message.
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch v := v.(type) {
+	case *message.Message:
+		data, err = marshalMessage(v)
+	case proto.Message:
+		data, err = proto.Marshal(v)
+	default:
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrCodecUnsupported).
+			NewFailedToError(customerror.WithField("contentType", Protobuf.ContentType()))
+	}
+
+	if err != nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSharedMarshal).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return data, nil
+}
+
+// Unmarshal decodes `data` into `v`, a `*message.Message`, or a Protobuf
+// message.
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	var err error
+
+	switch v := v.(type) {
+	case *message.Message:
+		err = unmarshalMessage(data, v)
+	case proto.Message:
+		err = proto.Unmarshal(data, v)
+	default:
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrCodecUnsupported).
+			NewFailedToError(customerror.WithField("contentType", Protobuf.ContentType()))
+	}
+
+	if err != nil {
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSharedUnmarshal).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return nil
+}
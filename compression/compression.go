@@ -0,0 +1,263 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// ContentEncodingHeader is the message header recording the compressor used
+// to compress a payload, so consumers decompress it automatically.
+const ContentEncodingHeader = "Content-Encoding"
+
+// DefaultThreshold is the default payload size, in bytes, from which payloads
+// are compressed.
+const DefaultThreshold = 1024
+
+// DefaultMaxSize is the default maximum size, in bytes, payloads decompress
+// to. It protects consumers from decompression bombs.
+const DefaultMaxSize = 64 << 20
+
+// Compressor compresses, and decompresses payloads.
+type Compressor interface {
+	// Encoding identifies the compressor, e.g.: "gzip".
+	Encoding() string
+
+	// Compress compresses `data`.
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress decompresses `data`, failing if it exceeds `max` bytes,
+	// unless `max` is 0.
+	Decompress(data []byte, max int) ([]byte, error)
+}
+
+// Registry.
+var (
+	mu       sync.RWMutex
+	registry = map[string]Compressor{}
+)
+
+//////
+// Helpers.
+//////
+
+// compressError returns the error used when compressing fails.
+func compressError(encoding string, err error) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrCompressionCompress).
+		NewFailedToError(
+			customerror.WithError(err),
+			customerror.WithField("encoding", encoding),
+		)
+}
+
+// decompressError returns the error used when decompressing fails.
+func decompressError(encoding string, err error) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrCompressionDecompress).
+		NewFailedToError(
+			customerror.WithError(err),
+			customerror.WithField("encoding", encoding),
+		)
+}
+
+// tooLargeError returns the error used when decompressed data exceeds `max`.
+func tooLargeError(encoding string, max int) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrCompressionTooLarge).
+		NewFailedToError(
+			customerror.WithField("encoding", encoding),
+			customerror.WithField("max", max),
+		)
+}
+
+// readAll reads `r`, decompressing with `encoding`, up to `max` bytes, unless
+// `max` is 0.
+func readAll(encoding string, r io.Reader, max int) ([]byte, error) {
+	if max > 0 {
+		r = io.LimitReader(r, int64(max)+1)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, decompressError(encoding, err)
+	}
+
+	if max > 0 && len(b) > max {
+		return nil, tooLargeError(encoding, max)
+	}
+
+	return b, nil
+}
+
+//////
+// Built-in compressors.
+//////
+
+// GzipCompressor is the gzip compressor.
+type GzipCompressor struct{}
+
+// Encoding identifies the compressor.
+func (GzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+// Compress compresses `data`.
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, compressError(c.Encoding(), err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, compressError(c.Encoding(), err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses `data`, up to `max` bytes, unless `max` is 0.
+func (c GzipCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, decompressError(c.Encoding(), err)
+	}
+
+	defer r.Close()
+
+	return readAll(c.Encoding(), r, max)
+}
+
+// ZstdCompressor is the zstd compressor.
+type ZstdCompressor struct {
+	enc *zstd.Encoder
+}
+
+// Encoding identifies the compressor.
+func (*ZstdCompressor) Encoding() string {
+	return "zstd"
+}
+
+// Compress compresses `data`.
+func (c *ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.enc.EncodeAll(data, nil), nil
+}
+
+// Decompress decompresses `data`, up to `max` bytes, unless `max` is 0. It's
+// streamed, so oversized payloads are never fully decompressed.
+func (c *ZstdCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	r, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, decompressError(c.Encoding(), err)
+	}
+
+	defer r.Close()
+
+	return readAll(c.Encoding(), r, max)
+}
+
+// newZstd creates the zstd compressor.
+func newZstd() *ZstdCompressor {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return &ZstdCompressor{enc: enc}
+}
+
+// SnappyCompressor is the snappy compressor.
+type SnappyCompressor struct{}
+
+// Encoding identifies the compressor.
+func (SnappyCompressor) Encoding() string {
+	return "snappy"
+}
+
+// Compress compresses `data`.
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress decompresses `data`, up to `max` bytes, unless `max` is 0. The
+// size is checked before decompressing, it's recorded in `data`.
+func (c SnappyCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, decompressError(c.Encoding(), err)
+	}
+
+	if max > 0 && n > max {
+		return nil, tooLargeError(c.Encoding(), max)
+	}
+
+	b, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, decompressError(c.Encoding(), err)
+	}
+
+	return b, nil
+}
+
+// Built-in compressors.
+var (
+	// Gzip is the gzip compressor.
+	Gzip Compressor = GzipCompressor{}
+
+	// Zstd is the zstd compressor.
+	Zstd Compressor = newZstd()
+
+	// Snappy is the snappy compressor.
+	Snappy Compressor = SnappyCompressor{}
+)
+
+//////
+// Exported functionalities.
+//////
+
+// Register makes `c` available to decompress payloads compressed with it.
+// Registering a compressor with the encoding of another, replaces it.
+func Register(c Compressor) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	registry[c.Encoding()] = c
+}
+
+// Get returns the compressor registered for `encoding`.
+func Get(encoding string) (Compressor, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := registry[encoding]
+	if !ok {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrCompressionUnknown).
+			NewFailedToError(customerror.WithField("encoding", encoding))
+	}
+
+	return c, nil
+}
+
+func init() {
+	Register(Gzip)
+	Register(Zstd)
+	Register(Snappy)
+}
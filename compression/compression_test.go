@@ -0,0 +1,68 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("pubsub"), 1024)
+
+	tests := []struct {
+		name       string
+		compressor Compressor
+	}{
+		{
+			name:       "Should work - gzip",
+			compressor: Gzip,
+		},
+		{
+			name:       "Should work - zstd",
+			compressor: Zstd,
+		},
+		{
+			name:       "Should work - snappy",
+			compressor: Snappy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Registered, so consumers find it.
+			c, err := Get(tt.compressor.Encoding())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.compressor, c)
+
+			compressed, err := c.Compress(data)
+			assert.NoError(t, err)
+			assert.Less(t, len(compressed), len(data))
+
+			got, err := c.Decompress(compressed, DefaultMaxSize)
+			assert.NoError(t, err)
+			assert.Equal(t, data, got)
+
+			// Exactly the maximum size, and unlimited.
+			got, err = c.Decompress(compressed, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, got)
+
+			got, err = c.Decompress(compressed, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, data, got)
+
+			// Exceeding the maximum size fails.
+			_, err = c.Decompress(compressed, len(data)-1)
+			assert.ErrorContains(t, err, "maximum size")
+
+			// Corrupted data fails.
+			_, err = c.Decompress([]byte("corrupted"), DefaultMaxSize)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	_, err := Get("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,3 @@
+// Package compression provides how messages payloads are compressed when
+// transported: gzip, zstd, and snappy.
+package compression
@@ -0,0 +1,46 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Store records the keys of processed messages.
+type Store interface {
+	// Exists returns if `key` is recorded, and not expired.
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// Add records `key`.
+	Add(ctx context.Context, key string) error
+}
+
+// KeyFunc returns the key identifying `msg`.
+type KeyFunc func(msg *message.Message) string
+
+//////
+// Exported functionalities.
+//////
+
+// ByID identifies messages by their ID.
+func ByID(msg *message.Message) string {
+	return msg.ID
+}
+
+// ByContent identifies messages by their content, see
+// `message.Message.ContentID`, so messages with the same content are
+// duplicates, even if published with different IDs.
+func ByContent(msg *message.Message) string {
+	id, err := msg.ContentID()
+	if err != nil {
+		return shared.GenerateID(msg.Topic + "\x00" + fmt.Sprint(msg.Data))
+	}
+
+	return id
+}
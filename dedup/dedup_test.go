@@ -0,0 +1,199 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// testStore tests the `Store` contract: keys are recorded, and expire.
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	exists, err := s.Exists(ctx, "k1")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, s.Add(ctx, "k1"))
+
+	// Recording twice is fine.
+	assert.NoError(t, s.Add(ctx, "k1"))
+
+	exists, err = s.Exists(ctx, "k1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Eventually(t, func() bool {
+		exists, err := s.Exists(ctx, "k1")
+
+		return err == nil && !exists
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+}
+
+func TestKeyFunc(t *testing.T) {
+	m1 := message.MustNew("v1.meta.created", shared.TestData)
+	m2 := message.MustNew("v1.meta.created", shared.TestData)
+	m3 := message.MustNew("v1.meta.updated", shared.TestData)
+
+	assert.Equal(t, m1.ID, ByID(m1))
+	assert.NotEqual(t, ByID(m1), ByID(m2))
+
+	assert.Equal(t, ByContent(m1), ByContent(m2))
+	assert.NotEqual(t, ByContent(m1), ByContent(m3))
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory(10, 50*time.Millisecond))
+
+	ctx := context.Background()
+
+	// Evicts the least recently used key.
+	s := NewMemory(2, 0)
+
+	assert.NoError(t, s.Add(ctx, "k1"))
+	assert.NoError(t, s.Add(ctx, "k2"))
+
+	exists, err := s.Exists(ctx, "k1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.NoError(t, s.Add(ctx, "k3"))
+	assert.Equal(t, 2, s.Len())
+
+	exists, err = s.Exists(ctx, "k2")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = s.Exists(ctx, "k1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+
+	s, err := NewFile(path, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	testStore(t, s)
+	assert.NoError(t, s.Close())
+
+	ctx := context.Background()
+
+	// Survives restarts.
+	s, err = NewFile(path, 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Add(ctx, "k2"))
+	assert.NoError(t, s.Close())
+
+	s, err = NewFile(path, 0)
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	exists, err := s.Exists(ctx, "k2")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// Expired keys are compacted.
+	exists, err = s.Exists(ctx, "k1")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.Len(t, s.keys, 1)
+
+	// Expired keys are compacted while running too, once the file has grown.
+	path = filepath.Join(t.TempDir(), "dedup")
+
+	s, err = NewFile(path, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	assert.NoError(t, s.Add(ctx, "k1"))
+	assert.NoError(t, s.Add(ctx, "k2"))
+
+	time.Sleep(20 * time.Millisecond)
+
+	s.compactAt = s.lines + 1
+
+	assert.NoError(t, s.Add(ctx, "k3"))
+	assert.Len(t, s.keys, 1)
+	assert.Equal(t, 1, s.lines)
+	assert.Equal(t, 2+compactThreshold, s.compactAt)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+	assert.Contains(t, string(b), " k3\n")
+}
+
+func TestSQL(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "dedup.db"))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	s, err := NewSQL(ctx, db, nil, "", 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTable, s.Table)
+
+	testStore(t, s)
+
+	assert.NoError(t, s.Purge(ctx))
+
+	var count int
+
+	assert.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+DefaultTable).Scan(&count))
+	assert.Equal(t, 0, count)
+
+	// Bound to the database, not the instance.
+	s, err = NewSQL(ctx, db, nil, "", 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Add(ctx, "k2"))
+
+	s, err = NewSQL(ctx, db, nil, "", 0)
+	require.NoError(t, err)
+
+	exists, err := s.Exists(ctx, "k2")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// SQLite allows a single writer.
+	db.SetMaxOpenConns(1)
+
+	// Concurrent additions of the same key don't fail.
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, s.Add(ctx, "k3"))
+		}()
+	}
+
+	wg.Wait()
+
+	exists, err = s.Exists(ctx, "k3")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -0,0 +1,4 @@
+// Package dedup provides idempotent consumption: processed message keys are
+// recorded in a pluggable store (in-memory LRU, file, or SQL), so redelivered
+// messages are skipped.
+package dedup
@@ -0,0 +1,262 @@
+package dedup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// compactThreshold is the minimum amount of stale lines, expired, or recorded
+// again keys, from which the file is compacted.
+const compactThreshold = 1024
+
+// File is a file-backed store, recording keys for `ttl`, surviving restarts.
+// Keys are appended, one per line, with their expiry, and held in memory. The
+// file is compacted, dropping expired keys, when opened, and once it's grown
+// to twice the keys it held when last compacted, plus `compactThreshold`
+// lines, so it's rewritten in amortized constant time.
+type File struct {
+	mu        sync.Mutex
+	f         *os.File
+	keys      map[string]time.Time
+	lines     int
+	compactAt int
+	path      string
+	ttl       time.Duration
+}
+
+//////
+// Helpers.
+//////
+
+// fileError returns the error used when the file can't be read, or written.
+func fileError(path string, err error) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrDedupFile).
+		NewFailedToError(
+			customerror.WithError(err),
+			customerror.WithField("path", path),
+		)
+}
+
+// formatLine formats a file line: the expiry, in Unix nanoseconds, zero if it
+// never expires, and the key.
+func formatLine(key string, expiresAt time.Time) string {
+	var ns int64
+
+	if !expiresAt.IsZero() {
+		ns = expiresAt.UnixNano()
+	}
+
+	return fmt.Sprintf("%d %s\n", ns, key)
+}
+
+// load reads the keys not expired from the file, if any.
+func (f *File) load() error {
+	r, err := os.Open(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	defer r.Close()
+
+	now := time.Now()
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		ns, key, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || key == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(ns, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		var expiresAt time.Time
+
+		if n > 0 {
+			expiresAt = time.Unix(0, n)
+		}
+
+		if (&entry{expiresAt: expiresAt}).expired(now) {
+			delete(f.keys, key)
+
+			continue
+		}
+
+		f.keys[key] = expiresAt
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites the file with the keys not expired, and opens it for
+// appending.
+func (f *File) compact() error {
+	now := time.Now()
+
+	for key, expiresAt := range f.keys {
+		if (&entry{expiresAt: expiresAt}).expired(now) {
+			delete(f.keys, key)
+		}
+	}
+
+	tmp := f.path + ".tmp"
+
+	w, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for key, expiresAt := range f.keys {
+		if _, err := bw.WriteString(formatLine(key, expiresAt)); err != nil {
+			w.Close()
+
+			return err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		w.Close()
+
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+
+	if f.f != nil {
+		if err := f.f.Close(); err != nil {
+			return err
+		}
+	}
+
+	f.f, err = os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	f.lines = len(f.keys)
+	f.compactAt = 2*len(f.keys) + compactThreshold
+
+	return nil
+}
+
+//////
+// Methods.
+//////
+
+// Exists returns if `key` is recorded, and not expired.
+func (f *File) Exists(_ context.Context, key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	expiresAt, ok := f.keys[key]
+	if !ok {
+		return false, nil
+	}
+
+	if (&entry{expiresAt: expiresAt}).expired(time.Now()) {
+		delete(f.keys, key)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Add records `key`, syncing the file, compacting it if needed.
+func (f *File) Add(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var expiresAt time.Time
+
+	if f.ttl > 0 {
+		expiresAt = time.Now().Add(f.ttl)
+	}
+
+	if _, err := f.f.WriteString(formatLine(key, expiresAt)); err != nil {
+		return fileError(f.path, err)
+	}
+
+	if err := f.f.Sync(); err != nil {
+		return fileError(f.path, err)
+	}
+
+	f.keys[key] = expiresAt
+	f.lines++
+
+	if f.lines >= f.compactAt {
+		if err := f.compact(); err != nil {
+			return fileError(f.path, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.f.Close(); err != nil {
+		return fileError(f.path, err)
+	}
+
+	return nil
+}
+
+//////
+// Factory.
+//////
+
+// NewFile creates a file-backed store at `path`, recording keys for `ttl`,
+// loading, and compacting the keys previously recorded, if any. Zero `ttl`
+// means keys never expire. Keys can't contain line breaks.
+func NewFile(path string, ttl time.Duration) (*File, error) {
+	f := &File{
+		keys: make(map[string]time.Time),
+		path: path,
+		ttl:  ttl,
+	}
+
+	if err := f.load(); err != nil {
+		return nil, fileError(path, err)
+	}
+
+	if err := f.compact(); err != nil {
+		return nil, fileError(path, err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,117 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// entry is a recorded key.
+type entry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// Memory is an in-memory LRU store, holding up to `size` keys, for `ttl`. Keys
+// are lost on restarts.
+type Memory struct {
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List
+	size  int
+	ttl   time.Duration
+}
+
+//////
+// Helpers.
+//////
+
+// expired returns if `e` expired.
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+//////
+// Methods.
+//////
+
+// Exists returns if `key` is recorded, and not expired.
+func (m *Memory) Exists(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.keys[key]
+	if !ok {
+		return false, nil
+	}
+
+	if el.Value.(*entry).expired(time.Now()) {
+		m.order.Remove(el)
+		delete(m.keys, key)
+
+		return false, nil
+	}
+
+	m.order.MoveToFront(el)
+
+	return true, nil
+}
+
+// Add records `key`, evicting the least recently used key, if full.
+func (m *Memory) Add(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expiresAt time.Time
+
+	if m.ttl > 0 {
+		expiresAt = time.Now().Add(m.ttl)
+	}
+
+	if el, ok := m.keys[key]; ok {
+		el.Value.(*entry).expiresAt = expiresAt
+		m.order.MoveToFront(el)
+
+		return nil
+	}
+
+	m.keys[key] = m.order.PushFront(&entry{key: key, expiresAt: expiresAt})
+
+	for m.size > 0 && m.order.Len() > m.size {
+		el := m.order.Back()
+
+		m.order.Remove(el)
+		delete(m.keys, el.Value.(*entry).key)
+	}
+
+	return nil
+}
+
+// Len returns the amount of recorded keys, including expired ones not evicted
+// yet.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+//////
+// Factory.
+//////
+
+// NewMemory creates an in-memory LRU store, holding up to `size` keys, for
+// `ttl`. Zero `size` means unbounded, zero `ttl` means keys never expire.
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{
+		keys:  make(map[string]*list.Element),
+		order: list.New(),
+		size:  size,
+		ttl:   ttl,
+	}
+}
@@ -0,0 +1,149 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/dialect"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/sqlutil"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// DefaultTable is the default table recording the keys.
+const DefaultTable = "pubsub_dedup"
+
+// SQL is a SQL-backed store, recording keys for `ttl` in `Table`, shared by
+// all consumers using the database.
+type SQL struct {
+	// DB is the database.
+	DB *sql.DB
+
+	// Dialect of the database.
+	Dialect *dialect.Dialect
+
+	// Table recording the keys.
+	Table string
+
+	ttl time.Duration
+}
+
+//////
+// Helpers.
+//////
+
+// sqlError returns the error used when a query fails.
+func sqlError(table string, err error) error {
+	return sqlutil.Error(errorcatalog.PubSubErrDedupSQL, table, err)
+}
+
+//////
+// Methods.
+//////
+
+// Exists returns if `key` is recorded, and not expired.
+func (s *SQL) Exists(ctx context.Context, key string) (bool, error) {
+	var expiresAt int64
+
+	if err := s.DB.QueryRowContext(
+		ctx,
+		fmt.Sprintf("SELECT expires_at FROM %s WHERE id = %s", s.Table, s.Dialect.Placeholder(1)),
+		key,
+	).Scan(&expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, sqlError(s.Table, err)
+	}
+
+	return expiresAt == 0 || time.Now().UnixNano() < expiresAt, nil
+}
+
+// Add records `key`, or renews it, if already recorded. It's inserted ignoring
+// conflicts, then renewed, so concurrent additions of the same key don't fail.
+func (s *SQL) Add(ctx context.Context, key string) error {
+	var expiresAt int64
+
+	if s.ttl > 0 {
+		expiresAt = time.Now().Add(s.ttl).UnixNano()
+	}
+
+	res, err := s.DB.ExecContext(ctx, s.Dialect.InsertIgnoring(s.Table, "id", "expires_at"), key, expiresAt)
+	if err != nil {
+		return sqlError(s.Table, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return sqlError(s.Table, err)
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	if _, err := s.DB.ExecContext(
+		ctx,
+		fmt.Sprintf("UPDATE %s SET expires_at = %s WHERE id = %s", s.Table, s.Dialect.Placeholder(1), s.Dialect.Placeholder(2)),
+		expiresAt, key,
+	); err != nil {
+		return sqlError(s.Table, err)
+	}
+
+	return nil
+}
+
+// Purge deletes the expired keys.
+func (s *SQL) Purge(ctx context.Context) error {
+	if _, err := s.DB.ExecContext(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE expires_at > 0 AND expires_at <= %s", s.Table, s.Dialect.Placeholder(1)),
+		time.Now().UnixNano(),
+	); err != nil {
+		return sqlError(s.Table, err)
+	}
+
+	return nil
+}
+
+//////
+// Factory.
+//////
+
+// NewSQL creates a SQL-backed store, recording keys for `ttl` in `table`
+// (defaults to `DefaultTable`), of a database of dialect `d` (defaults to
+// `dialect.SQLite`), creating it, if needed. Zero `ttl` means keys never
+// expire. `table` isn't escaped, it shouldn't come from user input.
+func NewSQL(ctx context.Context, db *sql.DB, d *dialect.Dialect, table string, ttl time.Duration) (*SQL, error) {
+	if d == nil {
+		d = dialect.SQLite
+	}
+
+	if table == "" {
+		table = DefaultTable
+	}
+
+	s := &SQL{
+		DB:      db,
+		Dialect: d,
+		Table:   table,
+
+		ttl: ttl,
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(255) PRIMARY KEY, expires_at BIGINT NOT NULL)", table),
+	); err != nil {
+		return nil, sqlError(table, err)
+	}
+
+	return s, nil
+}
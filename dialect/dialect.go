@@ -0,0 +1,102 @@
+package dialect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Dialect is a SQL dialect.
+type Dialect struct {
+	// Name of the dialect, e.g.: "sqlite".
+	Name string
+
+	// Placeholder returns the `n`th (1-based) query placeholder.
+	Placeholder func(n int) string
+
+	// AutoIncrement is the column definition of an integer primary key,
+	// assigned by the database, strictly increasing.
+	AutoIncrement string
+
+	// InsertIgnore is the format of an insert statement which skips rows
+	// conflicting with a unique key, instead of failing, with the table, the
+	// columns, and the values.
+	InsertIgnore string
+}
+
+// Dialects.
+var (
+	// SQLite dialect.
+	SQLite = &Dialect{
+		Name:          "sqlite",
+		Placeholder:   QuestionPlaceholder,
+		AutoIncrement: "INTEGER PRIMARY KEY AUTOINCREMENT",
+		InsertIgnore:  "INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+	}
+
+	// MySQL dialect.
+	MySQL = &Dialect{
+		Name:          "mysql",
+		Placeholder:   QuestionPlaceholder,
+		AutoIncrement: "BIGINT AUTO_INCREMENT PRIMARY KEY",
+		InsertIgnore:  "INSERT IGNORE INTO %s (%s) VALUES (%s)",
+	}
+
+	// PostgreSQL dialect.
+	PostgreSQL = &Dialect{
+		Name:          "postgres",
+		Placeholder:   DollarPlaceholder,
+		AutoIncrement: "BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY",
+		InsertIgnore:  "INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+	}
+)
+
+//////
+// Exported functionalities.
+//////
+
+// QuestionPlaceholder returns "?" placeholders, e.g.: MySQL, and SQLite.
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder returns "$n" placeholders, e.g.: PostgreSQL.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+//////
+// Methods.
+//////
+
+// Placeholders returns `n` comma-separated placeholders, from `from`.
+func (d *Dialect) Placeholders(from, n int) string {
+	p := make([]string, n)
+
+	for i := range p {
+		p[i] = d.Placeholder(from + i)
+	}
+
+	return strings.Join(p, ", ")
+}
+
+// Insert returns an insert statement into `table` of `columns`.
+func (d *Dialect) Insert(table string, columns ...string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(columns, ", "), d.Placeholders(1, len(columns)),
+	)
+}
+
+// InsertIgnoring returns an insert statement into `table` of `columns`, which
+// skips rows conflicting with a unique key, see `InsertIgnore`.
+func (d *Dialect) InsertIgnoring(table string, columns ...string) string {
+	return fmt.Sprintf(
+		d.InsertIgnore,
+		table, strings.Join(columns, ", "), d.Placeholders(1, len(columns)),
+	)
+}
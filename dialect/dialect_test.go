@@ -0,0 +1,21 @@
+package dialect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect(t *testing.T) {
+	assert.Equal(t, "?", QuestionPlaceholder(2))
+	assert.Equal(t, "$2", DollarPlaceholder(2))
+
+	assert.Equal(t, "$2, $3", PostgreSQL.Placeholders(2, 2))
+
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES (?, ?)", SQLite.Insert("t", "a", "b"))
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES ($1, $2)", PostgreSQL.Insert("t", "a", "b"))
+
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES (?, ?) ON CONFLICT DO NOTHING", SQLite.InsertIgnoring("t", "a", "b"))
+	assert.Equal(t, "INSERT IGNORE INTO t (a, b) VALUES (?, ?)", MySQL.InsertIgnoring("t", "a", "b"))
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES ($1, $2) ON CONFLICT DO NOTHING", PostgreSQL.InsertIgnoring("t", "a", "b"))
+}
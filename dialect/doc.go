@@ -0,0 +1,4 @@
+// Package dialect provides the SQL dialects of the SQL-backed stores, e.g.:
+// the outbox, the inbox, and the dedup store: query placeholders, and the
+// statements which syntax differs per database.
+package dialect
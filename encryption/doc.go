@@ -0,0 +1,3 @@
+// Package encryption provides end-to-end encryption of messages, per topic
+// pattern, with AES-GCM, and pluggable key providers.
+package encryption
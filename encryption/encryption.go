@@ -0,0 +1,212 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"sync"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/name"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// KeyIDHeader is the message header recording the ID of the key used to
+// encrypt a message, so consumers decrypt it automatically.
+const KeyIDHeader = "Encryption-Key-Id"
+
+// KeyProvider provides encryption keys. Keys are AES-128, AES-192, or AES-256
+// keys (16, 24, or 32 bytes).
+type KeyProvider interface {
+	// Current returns the key to encrypt with, and its ID.
+	Current(ctx context.Context) (id string, key []byte, err error)
+
+	// Get returns the key `id`, to decrypt with.
+	Get(ctx context.Context, id string) ([]byte, error)
+}
+
+// rule is a topic pattern, and its key provider.
+type rule struct {
+	pattern  string
+	provider KeyProvider
+}
+
+// Encryptor encrypts, and decrypts messages per topic pattern.
+type Encryptor struct {
+	mu    sync.RWMutex
+	rules []rule
+}
+
+//////
+// Helpers.
+//////
+
+// keyNotFoundError returns the error used when a key is missing.
+func keyNotFoundError(topic, id string) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrEncryptionKeyNotFound).
+		NewFailedToError(
+			customerror.WithField("topic", topic),
+			customerror.WithField("keyID", id),
+		)
+}
+
+// newAEAD creates an AES-GCM cipher.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// provider returns the provider of the first rule matching `topic`, if any.
+func (e *Encryptor) provider(topic string) KeyProvider {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, r := range e.rules {
+		if name.Name(topic).Match(r.pattern) {
+			return r.provider
+		}
+	}
+
+	return nil
+}
+
+// key returns the key `id`. Providers of rules matching `topic` are tried
+// first, then the others, so messages routed to other topics, e.g.: poison,
+// or dead letter topics, can still be decrypted.
+func (e *Encryptor) key(ctx context.Context, topic, id string) ([]byte, error) {
+	e.mu.RLock()
+
+	providers := make([]KeyProvider, 0, len(e.rules))
+	others := make([]KeyProvider, 0, len(e.rules))
+
+	for _, r := range e.rules {
+		if name.Name(topic).Match(r.pattern) {
+			providers = append(providers, r.provider)
+		} else {
+			others = append(others, r.provider)
+		}
+	}
+
+	e.mu.RUnlock()
+
+	for _, p := range append(providers, others...) {
+		if key, err := p.Get(ctx, id); err == nil {
+			return key, nil
+		}
+	}
+
+	return nil, keyNotFoundError(topic, id)
+}
+
+//////
+// Methods.
+//////
+
+// Add encrypts messages published to topics matching `pattern` (see
+// `name.Name.Match`) with keys from `provider`. The first matching pattern
+// wins.
+func (e *Encryptor) Add(pattern string, provider KeyProvider) *Encryptor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = append(e.rules, rule{pattern: pattern, provider: provider})
+
+	return e
+}
+
+// Covers returns whether messages published to `topic` are encrypted, so
+// plaintext ones received from it should be rejected.
+func (e *Encryptor) Covers(topic string) bool {
+	return e.provider(topic) != nil
+}
+
+// Encrypt encrypts `plaintext` published to `topic` with the current key, if
+// `topic` matches a pattern. It returns the key ID, empty if not encrypted.
+func (e *Encryptor) Encrypt(ctx context.Context, topic string, plaintext []byte) ([]byte, string, error) {
+	p := e.provider(topic)
+	if p == nil {
+		return plaintext, "", nil
+	}
+
+	id, key, err := p.Current(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, "", errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionEncrypt).
+			NewFailedToError(customerror.WithError(err), customerror.WithField("keyID", id))
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, "", errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionEncrypt).
+			NewFailedToError(customerror.WithError(err), customerror.WithField("keyID", id))
+	}
+
+	// The key ID is authenticated.
+	return aead.Seal(nonce, nonce, plaintext, []byte(id)), id, nil
+}
+
+// Decrypt decrypts `ciphertext` received from `topic`, encrypted with the key
+// `id`.
+func (e *Encryptor) Decrypt(ctx context.Context, topic, id string, ciphertext []byte) ([]byte, error) {
+	key, err := e.key(ctx, topic, id)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionDecrypt).
+			NewFailedToError(customerror.WithError(err), customerror.WithField("keyID", id))
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionDecrypt).
+			NewFailedToError(customerror.WithField("keyID", id))
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionDecrypt).
+			NewFailedToError(customerror.WithError(err), customerror.WithField("keyID", id))
+	}
+
+	return plaintext, nil
+}
+
+//////
+// Factory.
+//////
+
+// New creates an encryptor. Configure it with `Add`.
+func New() *Encryptor {
+	return &Encryptor{}
+}
@@ -0,0 +1,60 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptor(t *testing.T) {
+	ctx := context.Background()
+
+	plaintext := []byte("pii")
+
+	ring, err := NewKeyRing("k1", bytes.Repeat([]byte("1"), 32))
+	assert.NoError(t, err)
+
+	e := New().Add("v1.billing.>", ring)
+
+	assert.True(t, e.Covers("v1.billing.charged"))
+	assert.False(t, e.Covers("v1.meta.created"))
+
+	// Topics not matching any pattern aren't encrypted.
+	got, id, err := e.Encrypt(ctx, "v1.meta.created", plaintext)
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+	assert.Equal(t, plaintext, got)
+
+	ciphertext, id, err := e.Encrypt(ctx, "v1.billing.charged", plaintext)
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", id)
+	assert.NotContains(t, string(ciphertext), string(plaintext))
+
+	// Previous keys still decrypt after a rotation.
+	assert.NoError(t, ring.Rotate("k2", bytes.Repeat([]byte("2"), 16)))
+
+	got, err = e.Decrypt(ctx, "v1.billing.charged", "k1", ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, got)
+
+	_, id, err = e.Encrypt(ctx, "v1.billing.charged", plaintext)
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", id)
+
+	// Tampered messages fail.
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	_, err = e.Decrypt(ctx, "v1.billing.charged", "k1", ciphertext)
+	assert.Error(t, err)
+
+	// Missing keys fail.
+	ring.Remove("k1")
+
+	_, err = e.Decrypt(ctx, "v1.billing.charged", "k1", ciphertext)
+	assert.Error(t, err)
+
+	// Invalid keys fail.
+	assert.Error(t, ring.Rotate("k3", []byte("short")))
+}
@@ -0,0 +1,109 @@
+package encryption
+
+import (
+	"context"
+	"sync"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// KeyRing is an in-memory key provider. Keys are rotated with `Rotate`,
+// previous keys are kept to decrypt messages encrypted with them.
+type KeyRing struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+//////
+// Helpers.
+//////
+
+// validateKey validates `key` is an AES key.
+func validateKey(id string, key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionInvalidKey).
+			NewFailedToError(customerror.WithField("keyID", id))
+	}
+}
+
+//////
+// Implements the KeyProvider interface.
+//////
+
+// Current returns the key to encrypt with, and its ID.
+func (k *KeyRing) Current(ctx context.Context) (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.current, k.keys[k.current], nil
+}
+
+// Get returns the key `id`.
+func (k *KeyRing) Get(ctx context.Context, id string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, keyNotFoundError("", id)
+	}
+
+	return key, nil
+}
+
+//////
+// Methods.
+//////
+
+// Rotate adds the key `id`, and makes it the one to encrypt with.
+func (k *KeyRing) Rotate(id string, key []byte) error {
+	if err := validateKey(id, key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[id] = key
+	k.current = id
+
+	return nil
+}
+
+// Remove removes the key `id`. Messages encrypted with it can't be decrypted
+// anymore. The current key can't be removed, rotate it first.
+func (k *KeyRing) Remove(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id != k.current {
+		delete(k.keys, id)
+	}
+}
+
+//////
+// Factory.
+//////
+
+// NewKeyRing creates a key ring, which current key is `key`, identified by
+// `id`.
+func NewKeyRing(id string, key []byte) (*KeyRing, error) {
+	k := &KeyRing{keys: map[string][]byte{}}
+
+	if err := k.Rotate(id, key); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
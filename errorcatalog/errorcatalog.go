@@ -17,16 +17,60 @@ var (
 )
 
 const (
-	PubSubErrPubSubNotImpl   = "PUBSUB_ERR_PUBSUB_NOT_IMPL"
-	PubSubErrNameName        = "PUBSUB_ERR_NAME_NAME"
-	PubSubErrNATANilMessage  = "PUBSUB_ERR_NATS_NIL_MESSAGE"
-	PubSubErrNATSPublish     = "PUBSUB_ERR_NATS_PUBLISH"
-	PubSubErrNATSSubscribe   = "PUBSUB_ERR_NATS_SUBSCRIBE"
-	PubSubErrSharedDecode    = "PUBSUB_ERR_SHARED_DECODE"
-	PubSubErrSharedEncode    = "PUBSUB_ERR_SHARED_ENCODE"
-	PubSubErrSharedMarshal   = "PUBSUB_ERR_SHARED_MARSHAL"
-	PubSubErrSharedRead      = "PUBSUB_ERR_SHARED_READ"
-	PubSubErrSharedUnmarshal = "PUBSUB_ERR_SHARED_UNMARSHAL"
+	PubSubErrPubSubNotImpl            = "PUBSUB_ERR_PUBSUB_NOT_IMPL"
+	PubSubErrBreakerOpen              = "PUBSUB_ERR_BREAKER_OPEN"
+	PubSubErrCodecUnknown             = "PUBSUB_ERR_CODEC_UNKNOWN"
+	PubSubErrCodecUnsupported         = "PUBSUB_ERR_CODEC_UNSUPPORTED"
+	PubSubErrCompressionCompress      = "PUBSUB_ERR_COMPRESSION_COMPRESS"
+	PubSubErrCompressionDecompress    = "PUBSUB_ERR_COMPRESSION_DECOMPRESS"
+	PubSubErrCompressionTooLarge      = "PUBSUB_ERR_COMPRESSION_TOO_LARGE"
+	PubSubErrCompressionUnknown       = "PUBSUB_ERR_COMPRESSION_UNKNOWN"
+	PubSubErrDedupFile                = "PUBSUB_ERR_DEDUP_FILE"
+	PubSubErrDedupSQL                 = "PUBSUB_ERR_DEDUP_SQL"
+	PubSubErrEncryptionDecrypt        = "PUBSUB_ERR_ENCRYPTION_DECRYPT"
+	PubSubErrEncryptionEncrypt        = "PUBSUB_ERR_ENCRYPTION_ENCRYPT"
+	PubSubErrEncryptionInvalidKey     = "PUBSUB_ERR_ENCRYPTION_INVALID_KEY"
+	PubSubErrEncryptionKeyNotFound    = "PUBSUB_ERR_ENCRYPTION_KEY_NOT_FOUND"
+	PubSubErrEncryptionPlaintext      = "PUBSUB_ERR_ENCRYPTION_PLAINTEXT"
+	PubSubErrInboxSQL                 = "PUBSUB_ERR_INBOX_SQL"
+	PubSubErrJetStreamConsumer        = "PUBSUB_ERR_JETSTREAM_CONSUMER"
+	PubSubErrJetStreamNext            = "PUBSUB_ERR_JETSTREAM_NEXT"
+	PubSubErrJetStreamNilMessage      = "PUBSUB_ERR_JETSTREAM_NIL_MESSAGE"
+	PubSubErrJetStreamPublish         = "PUBSUB_ERR_JETSTREAM_PUBLISH"
+	PubSubErrJetStreamRequest         = "PUBSUB_ERR_JETSTREAM_REQUEST"
+	PubSubErrJetStreamStream          = "PUBSUB_ERR_JETSTREAM_STREAM"
+	PubSubErrJetStreamSubscribe       = "PUBSUB_ERR_JETSTREAM_SUBSCRIBE"
+	PubSubErrJetStreamUnsubscribe     = "PUBSUB_ERR_JETSTREAM_UNSUBSCRIBE"
+	PubSubErrMemoryClosed             = "PUBSUB_ERR_MEMORY_CLOSED"
+	PubSubErrMemoryNilMessage         = "PUBSUB_ERR_MEMORY_NIL_MESSAGE"
+	PubSubErrMessageNotRequest        = "PUBSUB_ERR_MESSAGE_NOT_REQUEST"
+	PubSubErrNameName                 = "PUBSUB_ERR_NAME_NAME"
+	PubSubErrNATANilMessage           = "PUBSUB_ERR_NATS_NIL_MESSAGE"
+	PubSubErrNATSNext                 = "PUBSUB_ERR_NATS_NEXT"
+	PubSubErrNATSPublish              = "PUBSUB_ERR_NATS_PUBLISH"
+	PubSubErrNATSRequest              = "PUBSUB_ERR_NATS_REQUEST"
+	PubSubErrNATSSubscribe            = "PUBSUB_ERR_NATS_SUBSCRIBE"
+	PubSubErrNATSUnsubscribe          = "PUBSUB_ERR_NATS_UNSUBSCRIBE"
+	PubSubErrOutboxSQL                = "PUBSUB_ERR_OUTBOX_SQL"
+	PubSubErrPubSubIDMismatch         = "PUBSUB_ERR_PUBSUB_ID_MISMATCH"
+	PubSubErrPubSubNoReply            = "PUBSUB_ERR_PUBSUB_NO_REPLY"
+	PubSubErrPubSubPanic              = "PUBSUB_ERR_PUBSUB_PANIC"
+	PubSubErrPubSubUnverifiedReply    = "PUBSUB_ERR_PUBSUB_UNVERIFIED_REPLY"
+	PubSubErrSharedDecode             = "PUBSUB_ERR_SHARED_DECODE"
+	PubSubErrSharedEncode             = "PUBSUB_ERR_SHARED_ENCODE"
+	PubSubErrSharedMarshal            = "PUBSUB_ERR_SHARED_MARSHAL"
+	PubSubErrSharedRead               = "PUBSUB_ERR_SHARED_READ"
+	PubSubErrSharedUnmarshal          = "PUBSUB_ERR_SHARED_UNMARSHAL"
+	PubSubErrSigningInvalidKey        = "PUBSUB_ERR_SIGNING_INVALID_KEY"
+	PubSubErrSigningSign              = "PUBSUB_ERR_SIGNING_SIGN"
+	PubSubErrSigningUntrustedKey      = "PUBSUB_ERR_SIGNING_UNTRUSTED_KEY"
+	PubSubErrSigningVerify            = "PUBSUB_ERR_SIGNING_VERIFY"
+	PubSubErrSubscriptionFetchSize    = "PUBSUB_ERR_SUBSCRIPTION_FETCH_SIZE"
+	PubSubErrSubscriptionFull         = "PUBSUB_ERR_SUBSCRIPTION_FULL"
+	PubSubErrSubscriptionNotFound     = "PUBSUB_ERR_SUBSCRIPTION_NOT_FOUND"
+	PubSubErrSubscriptionNotSync      = "PUBSUB_ERR_SUBSCRIPTION_NOT_SYNC"
+	PubSubErrSubscriptionStopped      = "PUBSUB_ERR_SUBSCRIPTION_STOPPED"
+	PubSubErrSubscriptionUnsubscribed = "PUBSUB_ERR_SUBSCRIPTION_UNSUBSCRIBED"
 )
 
 //////
@@ -47,15 +91,59 @@ func Get() *customerror.Catalog {
 		//////
 
 		catalog.MustSet(PubSubErrPubSubNotImpl, "not implemented")
+		catalog.MustSet(PubSubErrBreakerOpen, "publish, circuit breaker is open, the broker is unhealthy")
+		catalog.MustSet(PubSubErrCodecUnknown, "get codec, unknown content type. Register it with `codec.Register`")
+		catalog.MustSet(PubSubErrCodecUnsupported, "encode, value isn't supported by the codec")
+		catalog.MustSet(PubSubErrCompressionCompress, "compress")
+		catalog.MustSet(PubSubErrCompressionDecompress, "decompress")
+		catalog.MustSet(PubSubErrCompressionTooLarge, "decompress, payload exceeds the maximum size")
+		catalog.MustSet(PubSubErrCompressionUnknown, "get compressor, unknown encoding. Register it with `compression.Register`")
+		catalog.MustSet(PubSubErrDedupFile, "read, or write the dedup file")
+		catalog.MustSet(PubSubErrDedupSQL, "query the dedup table")
+		catalog.MustSet(PubSubErrEncryptionDecrypt, "decrypt")
+		catalog.MustSet(PubSubErrEncryptionEncrypt, "encrypt")
+		catalog.MustSet(PubSubErrEncryptionInvalidKey, "use key, it should be 16, 24, or 32 bytes long")
+		catalog.MustSet(PubSubErrEncryptionKeyNotFound, "decrypt, key not found. Configure its key provider with `encryption.Encryptor.Add`")
+		catalog.MustSet(PubSubErrEncryptionPlaintext, "decrypt, message isn't encrypted, but its topic is")
+		catalog.MustSet(PubSubErrInboxSQL, "query the inbox table")
+		catalog.MustSet(PubSubErrJetStreamConsumer, "create, or bind consumer")
+		catalog.MustSet(PubSubErrJetStreamNext, "pull next message")
+		catalog.MustSet(PubSubErrJetStreamNilMessage, "get client, it's nil. Call `New`")
+		catalog.MustSet(PubSubErrJetStreamPublish, "publish, not acknowledged by the broker")
+		catalog.MustSet(PubSubErrJetStreamRequest, "request, not supported by JetStream. Use the `nats` pubsub")
+		catalog.MustSet(PubSubErrJetStreamStream, "create, or bind stream")
+		catalog.MustSet(PubSubErrJetStreamSubscribe, "subscribe")
+		catalog.MustSet(PubSubErrJetStreamUnsubscribe, "unsubscribe")
+		catalog.MustSet(PubSubErrMemoryClosed, "use memory pubsub, it's closed")
+		catalog.MustSet(PubSubErrMemoryNilMessage, "get client, it's nil. Call `New`")
+		catalog.MustSet(PubSubErrMessageNotRequest, "respond, message isn't a request. Publish it with `WithSync`")
 		catalog.MustSet(PubSubErrNameName, "name. It should be like `v1.meta.created` or `v1.meta.created.queue`")
 		catalog.MustSet(PubSubErrNATANilMessage, "get client, it's nil. Call `New`")
+		catalog.MustSet(PubSubErrNATSNext, "pull next message")
 		catalog.MustSet(PubSubErrNATSPublish, "publish")
+		catalog.MustSet(PubSubErrNATSRequest, "request")
 		catalog.MustSet(PubSubErrNATSSubscribe, "subscribe")
+		catalog.MustSet(PubSubErrNATSUnsubscribe, "unsubscribe")
+		catalog.MustSet(PubSubErrOutboxSQL, "query the outbox table")
+		catalog.MustSet(PubSubErrPubSubIDMismatch, "decode, message ID doesn't match the envelope one")
+		catalog.MustSet(PubSubErrPubSubNoReply, "get reply, no subscriber replied")
+		catalog.MustSet(PubSubErrPubSubPanic, "handle message, handler panicked")
+		catalog.MustSet(PubSubErrPubSubUnverifiedReply, "verify reply, its signature can't be verified")
 		catalog.MustSet(PubSubErrSharedDecode, "decode")
 		catalog.MustSet(PubSubErrSharedEncode, "encode")
 		catalog.MustSet(PubSubErrSharedMarshal, "marshal")
 		catalog.MustSet(PubSubErrSharedRead, "read")
 		catalog.MustSet(PubSubErrSharedUnmarshal, "unmarshal")
+		catalog.MustSet(PubSubErrSigningInvalidKey, "use signing key, it should have an ID, and the right size")
+		catalog.MustSet(PubSubErrSigningSign, "sign")
+		catalog.MustSet(PubSubErrSigningUntrustedKey, "verify signature, key isn't trusted. Trust it with `signing.Signer.Trust`")
+		catalog.MustSet(PubSubErrSigningVerify, "verify signature")
+		catalog.MustSet(PubSubErrSubscriptionFetchSize, "fetch, amount of messages should be positive")
+		catalog.MustSet(PubSubErrSubscriptionFull, "deliver to channel, it's full. Read it faster, or increase its size")
+		catalog.MustSet(PubSubErrSubscriptionNotFound, "unsubscribe, subscription not found. Call `Subscribe` first")
+		catalog.MustSet(PubSubErrSubscriptionNotSync, "pull, subscription isn't synchronous. Subscribe with `WithSync`")
+		catalog.MustSet(PubSubErrSubscriptionStopped, "pull, subscription stopped")
+		catalog.MustSet(PubSubErrSubscriptionUnsubscribed, "subscribe, subscription was unsubscribed. Create a new one")
 
 		singleton = catalog
 	})
@@ -0,0 +1,4 @@
+// Package inbox provides the inbox pattern: received message keys are recorded
+// in a SQL table within the same transaction as the handler writes, so each
+// message is handled effectively once, atomically.
+package inbox
@@ -0,0 +1,176 @@
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/dedup"
+	"github.com/WreckingBallStudioLabs/pubsub/dialect"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/metrics"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/sqlutil"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// DefaultTable is the default inbox table.
+const DefaultTable = "pubsub_inbox"
+
+// HandlerFunc handles `msg`, writing within `tx`. Failing rolls `tx` back, so
+// the message can be handled again, if redelivered.
+type HandlerFunc func(ctx context.Context, tx *sql.Tx, msg *message.Message) error
+
+// Inbox records the keys of handled messages, per consumer, in `Table`, within
+// the handler transaction, see `Handler`.
+type Inbox struct {
+	// DB is the database.
+	DB *sql.DB
+
+	// Key identifies messages. Defaults to `dedup.ByID`.
+	Key dedup.KeyFunc
+
+	// Dialect of the database.
+	Dialect *dialect.Dialect
+
+	// Table recording the keys.
+	Table string
+
+	// Metrics.
+	counterDuplicated *expvar.Int
+}
+
+//////
+// Helpers.
+//////
+
+// sqlError returns the error used when a query fails.
+func sqlError(table string, err error) error {
+	return sqlutil.Error(errorcatalog.PubSubErrInboxSQL, table, err)
+}
+
+// record records `msg` key for `consumer` within `tx`, returning false if it's
+// already recorded. The key is inserted ignoring conflicts, so concurrent
+// deliveries of the same message record it once, the others wait for the
+// recording transaction, and are skipped if it commits.
+func (i *Inbox) record(ctx context.Context, tx *sql.Tx, consumer string, msg *message.Message) (bool, error) {
+	res, err := tx.ExecContext(
+		ctx,
+		i.Dialect.InsertIgnoring(i.Table, "consumer", "id", "topic", "received_at"),
+		consumer, i.Key(msg), msg.Topic, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return false, sqlError(i.Table, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, sqlError(i.Table, err)
+	}
+
+	return n > 0, nil
+}
+
+//////
+// Methods.
+//////
+
+// GetDuplicatedCounter returns the metric.
+func (i *Inbox) GetDuplicatedCounter() *expvar.Int {
+	return i.counterDuplicated
+}
+
+// Handler wraps `h` into a subscription handler, see
+// `subscription.NewWithHandler`, working with any pubsub. Each message is
+// handled within a transaction, which also records its key for `consumer`,
+// e.g.: the subscription queue. Messages which key is recorded for `consumer`
+// are skipped, so consumers sharing the table don't skip each other messages.
+// If `h` fails, the transaction is rolled back, and the failure reported, so
+// the message is redelivered by pubsubs supporting it.
+func (i *Inbox) Handler(consumer string, h HandlerFunc) subscription.HandlerFunc {
+	return func(ctx context.Context, msg *message.Message) error {
+		tx, err := i.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return sqlError(i.Table, err)
+		}
+
+		defer func() { _ = tx.Rollback() }()
+
+		recorded, err := i.record(ctx, tx, consumer, msg)
+		if err != nil {
+			return err
+		}
+
+		if !recorded {
+			i.counterDuplicated.Add(1)
+
+			return nil
+		}
+
+		if err := h(ctx, tx, msg); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return sqlError(i.Table, err)
+		}
+
+		return nil
+	}
+}
+
+// Purge deletes the keys recorded before `before`. Messages redelivered after
+// their key is purged are handled again.
+func (i *Inbox) Purge(ctx context.Context, before time.Time) error {
+	if _, err := i.DB.ExecContext(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE received_at < %s", i.Table, i.Dialect.Placeholder(1)),
+		before.UnixNano(),
+	); err != nil {
+		return sqlError(i.Table, err)
+	}
+
+	return nil
+}
+
+//////
+// Factory.
+//////
+
+// New creates an inbox stored in `table` (defaults to `DefaultTable`), of a
+// database of dialect `d` (defaults to `dialect.SQLite`), creating it, if
+// needed. `table` isn't escaped, it shouldn't come from user input.
+func New(ctx context.Context, db *sql.DB, d *dialect.Dialect, table string) (*Inbox, error) {
+	if d == nil {
+		d = dialect.SQLite
+	}
+
+	if table == "" {
+		table = DefaultTable
+	}
+
+	i := &Inbox{
+		DB:      db,
+		Dialect: d,
+		Key:     dedup.ByID,
+		Table:   table,
+
+		counterDuplicated: metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", "inbox", table, "duplicated", pubsub.DefaultMetricCounterLabel)),
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (consumer VARCHAR(255) NOT NULL, id VARCHAR(255) NOT NULL, topic VARCHAR(255) NOT NULL, received_at BIGINT NOT NULL, PRIMARY KEY (consumer, id))",
+		table,
+	)); err != nil {
+		return nil, sqlError(table, err)
+	}
+
+	return i, nil
+}
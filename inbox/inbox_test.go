@@ -0,0 +1,152 @@
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/dedup"
+	"github.com/WreckingBallStudioLabs/pubsub/dialect"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/memory"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// setup opens a database, with an `orders` table written by handlers.
+func setup(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "inbox.db"))
+	require.NoError(t, err)
+
+	// SQLite allows a single writer.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE orders (id VARCHAR(255) PRIMARY KEY)")
+	require.NoError(t, err)
+
+	return db
+}
+
+// count returns the amount of rows in `table`.
+func count(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+
+	var n int
+
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&n))
+
+	return n
+}
+
+// order writes an order, within `tx`.
+func order(ctx context.Context, tx *sql.Tx, msg *message.Message) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO orders (id) VALUES (?)", msg.ID)
+
+	return err
+}
+
+func TestInbox_Handler(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	db := setup(t)
+	defer db.Close()
+
+	i, err := New(ctx, db, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTable, i.Table)
+
+	errFailed := errors.New("failed")
+
+	fail := true
+
+	h := i.Handler("orders", func(ctx context.Context, tx *sql.Tx, msg *message.Message) error {
+		if err := order(ctx, tx, msg); err != nil {
+			return err
+		}
+
+		if fail {
+			return errFailed
+		}
+
+		return nil
+	})
+
+	msg := message.MustNew("v1.orders.placed", shared.TestData)
+
+	// Failures roll the handler writes, and the key back.
+	assert.ErrorIs(t, h(ctx, msg), errFailed)
+	assert.Equal(t, 0, count(t, db, "orders"))
+	assert.Equal(t, 0, count(t, db, DefaultTable))
+
+	fail = false
+
+	assert.NoError(t, h(ctx, msg))
+	assert.Equal(t, 1, count(t, db, "orders"))
+	assert.Equal(t, 1, count(t, db, DefaultTable))
+
+	// Duplicates are skipped.
+	assert.NoError(t, h(ctx, msg))
+	assert.Equal(t, 1, count(t, db, "orders"))
+	assert.Equal(t, int64(1), i.GetDuplicatedCounter().Value())
+
+	// Other consumers, sharing the table, still handle it.
+	handled := false
+
+	assert.NoError(t, i.Handler("billing", func(ctx context.Context, tx *sql.Tx, msg *message.Message) error {
+		handled = true
+
+		return nil
+	})(ctx, msg))
+	assert.True(t, handled)
+	assert.Equal(t, 2, count(t, db, DefaultTable))
+	assert.Equal(t, int64(1), i.GetDuplicatedCounter().Value())
+
+	assert.NoError(t, i.Purge(ctx, time.Now()))
+	assert.Equal(t, 0, count(t, db, DefaultTable))
+}
+
+func TestInbox_subscription(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	db := setup(t)
+	defer db.Close()
+
+	i, err := New(ctx, db, dialect.SQLite, "orders_inbox")
+	require.NoError(t, err)
+
+	i.Key = dedup.ByContent
+
+	client, err := memory.New(ctx)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNewWithHandler("v1.orders.placed", "v1.orders.placed.queue", i.Handler("v1.orders.placed.queue", order))
+
+	client.MustSubscribe(ctx, sub)
+
+	// The same event, published twice, with different IDs.
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	assert.Eventually(t, func() bool {
+		return i.GetDuplicatedCounter().Value() == 1
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	assert.Equal(t, 1, count(t, db, "orders"))
+	assert.Equal(t, 1, count(t, db, "orders_inbox"))
+}
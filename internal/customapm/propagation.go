@@ -0,0 +1,107 @@
+package customapm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.elastic.co/apm"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// TraceparentHeader is the W3C Trace Context header carrying the trace.
+//
+// SEE: https://www.w3.org/TR/trace-context/#traceparent-header
+const TraceparentHeader = "traceparent"
+
+//////
+// Helpers.
+//////
+
+// formatTraceparent formats `tc` as a W3C traceparent value.
+func formatTraceparent(tc apm.TraceContext) string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.Trace.String(), tc.Span.String(), uint8(tc.Options))
+}
+
+// parseTraceparent parses a W3C traceparent value.
+func parseTraceparent(value string) (apm.TraceContext, bool) {
+	var tc apm.TraceContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return tc, false
+	}
+
+	if n, err := hex.Decode(tc.Trace[:], []byte(parts[1])); err != nil || n != len(tc.Trace) {
+		return tc, false
+	}
+
+	if n, err := hex.Decode(tc.Span[:], []byte(parts[2])); err != nil || n != len(tc.Span) {
+		return tc, false
+	}
+
+	var flags [1]byte
+
+	if n, err := hex.Decode(flags[:], []byte(parts[3])); err != nil || n != len(flags) {
+		return tc, false
+	}
+
+	tc.Options = apm.TraceOptions(flags[0])
+
+	if tc.Trace.Validate() != nil || tc.Span.Validate() != nil {
+		return tc, false
+	}
+
+	return tc, true
+}
+
+//////
+// Exported functionalities.
+//////
+
+// Inject injects the trace context found in `ctx`, if any, into `headers`. The
+// current span is used as parent, otherwise the transaction.
+func Inject(ctx context.Context, headers map[string]string) map[string]string {
+	var tc apm.TraceContext
+
+	switch {
+	case apm.SpanFromContext(ctx) != nil:
+		tc = apm.SpanFromContext(ctx).TraceContext()
+	case apm.TransactionFromContext(ctx) != nil:
+		tc = apm.TransactionFromContext(ctx).TraceContext()
+	default:
+		return headers
+	}
+
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	headers[TraceparentHeader] = formatTraceparent(tc)
+
+	return headers
+}
+
+// Continue starts a new TX continuing the trace found in `headers`, if any,
+// otherwise it starts a new trace. The TX is added to the returned context.
+//
+// NOTE: It's up to the developer to call `tx.End()`.
+func Continue(
+	ctx context.Context,
+	headers map[string]string,
+	txName, txType string,
+) (context.Context, *apm.Transaction) {
+	opts := apm.TransactionOptions{}
+
+	if tc, ok := parseTraceparent(headers[TraceparentHeader]); ok {
+		opts.TraceContext = tc
+	}
+
+	tx := apm.DefaultTracer.StartTransactionOptions(txName, txType, opts)
+
+	return apm.ContextWithTransaction(ctx, tx), tx
+}
@@ -0,0 +1,36 @@
+package customapm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.elastic.co/apm"
+)
+
+func TestContinue(t *testing.T) {
+	tx := apm.DefaultTracer.StartTransaction("publish", "pubsub.test")
+	defer tx.End()
+
+	ctx, span := Trace(apm.ContextWithTransaction(context.Background(), tx), "pubsub", "test", "published")
+	defer span.End()
+
+	// Nothing to inject.
+	assert.Nil(t, Inject(context.Background(), nil))
+
+	headers := Inject(ctx, nil)
+	assert.NotEmpty(t, headers[TraceparentHeader])
+
+	// Continues the trace, with the publisher span as parent.
+	_, consumerTX := Continue(context.Background(), headers, "v1.meta.created", "pubsub.test")
+	defer consumerTX.End()
+
+	assert.Equal(t, tx.TraceContext().Trace, consumerTX.TraceContext().Trace)
+	assert.Equal(t, span.TraceContext().Span, consumerTX.ParentID())
+
+	// Invalid, or missing traceparent starts a new trace.
+	_, newTX := Continue(context.Background(), map[string]string{TraceparentHeader: "invalid"}, "v1.meta.created", "pubsub.test")
+	defer newTX.End()
+
+	assert.NotEqual(t, tx.TraceContext().Trace, newTX.TraceContext().Trace)
+}
@@ -4,15 +4,28 @@ import (
 	"expvar"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
 )
 
+//////
+// Vars, consts, and types.
+//////
+
+// mu serializes publishing, so a name is checked, and published atomically.
+var mu sync.Mutex
+
 //////
 // Exported functionalities.
 //////
 
 // NewInt creates and initializes a new expvar.Int.
+//
+// NOTE: expvar doesn't allow to publish the same name twice, nor unpublishing,
+// so if the metric already exists (e.g.: the same pubsub was instantiated more
+// than once), the counter isn't published: each instance counts on its own,
+// without resetting the published one, nor leaking names.
 func NewInt(name string) *expvar.Int {
 	prefix := os.Getenv("PUBSUB_METRICS_PREFIX")
 
@@ -22,15 +35,14 @@ func NewInt(name string) *expvar.Int {
 		prefix = "pubsub"
 	}
 
-	counter := expvar.NewInt(
-		fmt.Sprintf(
-			"%s.%s",
-			prefix,
-			name,
-		),
-	)
+	finalName := fmt.Sprintf("%s.%s", prefix, name)
+
+	mu.Lock()
+	defer mu.Unlock()
 
-	counter.Set(0)
+	if expvar.Get(finalName) != nil {
+		return new(expvar.Int)
+	}
 
-	return counter
+	return expvar.NewInt(finalName)
 }
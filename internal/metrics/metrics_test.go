@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInt(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	first := NewInt("metrics.counter")
+	first.Add(1)
+
+	// Instances count on their own.
+	second := NewInt("metrics.counter")
+	second.Add(2)
+
+	assert.Equal(t, int64(1), first.Value())
+	assert.Equal(t, int64(2), second.Value())
+
+	// Only the first is published.
+	assert.Same(t, first, expvar.Get("test.metrics.counter"))
+	assert.Nil(t, expvar.Get("test.metrics.counter.2"))
+}
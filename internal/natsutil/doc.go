@@ -0,0 +1,3 @@
+// Package natsutil provides what the NATS, and JetStream pubsubs share:
+// headers conversion, and the handling of their underlying subscriptions.
+package natsutil
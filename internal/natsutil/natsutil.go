@@ -0,0 +1,189 @@
+package natsutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/status"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Handle is the underlying NATS subscription of a subscription.
+type Handle struct {
+	// Subscription is the NATS subscription.
+	*natsgo.Subscription
+
+	// mu guards the fields below.
+	mu sync.Mutex
+
+	// cancel cancels the deliveries context, unblocking in-flight deliveries.
+	cancel context.CancelFunc
+
+	// inFlight is the amount of deliveries running.
+	inFlight int
+
+	// release closes the subscription channel, once stopped, and no delivery
+	// runs.
+	release func()
+
+	// stopped is true once no more deliveries should happen.
+	stopped bool
+}
+
+//////
+// Exported functionalities.
+//////
+
+// ToHeader converts message headers to NATS headers.
+func ToHeader(headers map[string]string) natsgo.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	h := natsgo.Header{}
+
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+
+	return h
+}
+
+// FromHeader converts NATS headers to message headers.
+func FromHeader(h natsgo.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(h))
+
+	for k := range h {
+		headers[k] = h.Get(k)
+	}
+
+	return headers
+}
+
+//////
+// Helpers.
+//////
+
+// done ends a delivery, closing the subscription channel, if it's the last
+// in-flight one of a stopped handle.
+func (h *Handle) done() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.inFlight--
+
+	if h.stopped && h.inFlight == 0 {
+		h.release()
+	}
+}
+
+//////
+// Methods.
+//////
+
+// Deliver runs `deliver`, unless stopped. The subscription channel isn't
+// closed meanwhile. It returns whether it ran.
+func (h *Handle) Deliver(deliver func()) bool {
+	h.mu.Lock()
+
+	if h.stopped {
+		h.mu.Unlock()
+
+		return false
+	}
+
+	h.inFlight++
+
+	h.mu.Unlock()
+
+	defer h.done()
+
+	deliver()
+
+	return true
+}
+
+// Stop stops delivering to `s`. It doesn't wait for in-flight deliveries, so
+// handlers can unsubscribe their own subscription: `s` channel is closed once
+// they are done. Stopped subscriptions can't be subscribed again.
+func (h *Handle) Stop(s *subscription.Subscription) error {
+	err := h.Unsubscribe()
+
+	h.cancel()
+
+	s.Status = status.Stopped
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stopped = true
+
+	h.release = func() {
+		if s.Channel != nil {
+			close(s.Channel)
+		}
+	}
+
+	if h.inFlight == 0 {
+		h.release()
+	}
+
+	return err
+}
+
+// Pull pulls the next message of the synchronous subscription `s`, converted
+// with `toEnvelope`. Failures are reported with the `code` error, unless the
+// subscription is stopped.
+func (h *Handle) Pull(
+	ctx context.Context,
+	s *subscription.Subscription,
+	code string,
+	toEnvelope func(m *natsgo.Msg) *pubsub.Envelope,
+) (*pubsub.Envelope, error) {
+	m, err := h.NextMsgWithContext(ctx)
+	if err != nil {
+		if errors.Is(err, natsgo.ErrBadSubscription) {
+			return nil, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrSubscriptionStopped).
+				NewFailedToError(
+					customerror.WithField("topic", s.Topic),
+					customerror.WithField("id", s.ID),
+				)
+		}
+
+		return nil, errorcatalog.
+			Get().
+			MustGet(code).
+			NewFailedToError(
+				customerror.WithError(err),
+				customerror.WithField("topic", s.Topic),
+				customerror.WithField("id", s.ID),
+			)
+	}
+
+	return toEnvelope(m), nil
+}
+
+//////
+// Factory.
+//////
+
+// NewHandle creates a handle, which `Stop` cancels the deliveries context with
+// `cancel`. Its NATS subscription is set once subscribed.
+func NewHandle(cancel context.CancelFunc) *Handle {
+	return &Handle{cancel: cancel}
+}
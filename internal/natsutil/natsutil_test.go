@@ -0,0 +1,21 @@
+package natsutil
+
+import (
+	"testing"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeader(t *testing.T) {
+	assert.Nil(t, ToHeader(nil))
+	assert.Nil(t, FromHeader(nil))
+
+	headers := map[string]string{"Content-Type": "application/json", "tenant": "acme"}
+
+	h := ToHeader(headers)
+
+	// Keys are kept as is, not canonicalized.
+	assert.Equal(t, natsgo.Header{"Content-Type": {"application/json"}, "tenant": {"acme"}}, h)
+	assert.Equal(t, headers, FromHeader(h))
+}
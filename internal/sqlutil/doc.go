@@ -0,0 +1,3 @@
+// Package sqlutil provides what the SQL-backed stores share, e.g.: the outbox,
+// the inbox, and the dedup store.
+package sqlutil
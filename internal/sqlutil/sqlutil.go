@@ -0,0 +1,21 @@
+package sqlutil
+
+import (
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Exported functionalities.
+//////
+
+// Error returns the `code` error used when a query on `table` fails.
+func Error(code, table string, err error) error {
+	return errorcatalog.
+		Get().
+		MustGet(code).
+		NewFailedToError(
+			customerror.WithError(err),
+			customerror.WithField("table", table),
+		)
+}
@@ -0,0 +1,5 @@
+// The jetstream package provides a NATS JetStream implementation of the pubsub
+// interface. Unlike core NATS, messages are persisted in streams, and
+// delivered to durable consumers, so they aren't lost while consumers are
+// down.
+package jetstream
@@ -0,0 +1,726 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/natsutil"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/eapache/go-resiliency/retrier"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/thalesfsp/concurrentloop"
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/status"
+	"github.com/thalesfsp/sypl"
+	"github.com/thalesfsp/sypl/fields"
+	"github.com/thalesfsp/sypl/level"
+	"github.com/thalesfsp/validation"
+)
+
+//////
+// Const, vars, and types.
+//////
+
+// Name is the name of the pubsub.
+const Name = "jetstream"
+
+// DefaultMaxDeliver is the default maximum amount of deliveries of a message,
+// for subscriptions without a max attempts count, see
+// `subscription.WithDeadLetter`, so poison messages aren't redelivered
+// forever. Once reached, the broker stops redelivering the message.
+const DefaultMaxDeliver = 10
+
+// Singleton.
+var singleton pubsub.IPubSub
+
+// Option is for the NATS configuration.
+type Option = natsgo.Option
+
+// acker acknowledges JetStream messages. Acknowledgements wait for the broker
+// confirmation.
+type acker struct {
+	m *natsgo.Msg
+}
+
+// JetStream pubsub definition.
+type JetStream struct {
+	*pubsub.PubSub
+
+	// Options are the NATS configuration.
+	Options []Option `json:"-" validate:"required"`
+
+	// Client is the NATS client.
+	Client *natsgo.Conn
+
+	// JS is the JetStream context.
+	JS natsgo.JetStreamContext `json:"-"`
+
+	// Stream is the configuration of the streams created per topic family,
+	// e.g.: retention, storage, and replicas. Name, and subjects are set per
+	// family, see `StreamName`. Existing streams are bound, as they are.
+	Stream natsgo.StreamConfig `json:"-"`
+
+	// URL is the NATS URL.
+	URL string `json:"url" validate:"required"`
+
+	// mu guards handles, and streams.
+	mu sync.Mutex
+
+	// handles are the underlying JetStream subscriptions, keyed by
+	// subscription.
+	handles map[*subscription.Subscription]*natsutil.Handle
+
+	// streams are the streams already created, or bound.
+	streams map[string]bool
+}
+
+//////
+// Helpers.
+//////
+
+// toEnvelope converts a JetStream message to an envelope, which can be
+// acknowledged.
+func toEnvelope(m *natsgo.Msg) *pubsub.Envelope {
+	e := &pubsub.Envelope{
+		Topic:   m.Subject,
+		Headers: natsutil.FromHeader(m.Header),
+		Payload: m.Data,
+		Acker:   &acker{m: m},
+	}
+
+	// Routed envelopes, e.g.: dead-lettered, shouldn't be deduplicated.
+	delete(e.Headers, natsgo.MsgIdHdr)
+
+	if meta, err := m.Metadata(); err == nil {
+		e.Attempt = int(meta.NumDelivered)
+	}
+
+	return e
+}
+
+// family returns the family of `topic`: its version, and domain, e.g.:
+// "v1.meta" for "v1.meta.created".
+func family(topic string) string {
+	parts := strings.Split(topic, ".")
+
+	if len(parts) < 2 {
+		return topic
+	}
+
+	return strings.Join(parts[:2], ".")
+}
+
+// durable returns the durable consumer name of `queue`. Consumer names can't
+// contain dots.
+func durable(queue string) string {
+	return strings.ReplaceAll(queue, ".", "_")
+}
+
+// stream creates, or binds the stream of `topic` family, returning its name.
+func (j *JetStream) stream(topic string) (string, error) {
+	name := StreamName(topic)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.streams[name] {
+		return name, nil
+	}
+
+	if _, err := j.JS.StreamInfo(name); err != nil {
+		if !errors.Is(err, natsgo.ErrStreamNotFound) {
+			return "", j.streamError(err, name)
+		}
+
+		cfg := j.Stream
+		cfg.Name = name
+		cfg.Subjects = []string{family(topic) + ".>"}
+
+		if _, err := j.JS.AddStream(&cfg); err != nil {
+			return "", j.streamError(err, name)
+		}
+	}
+
+	j.streams[name] = true
+
+	return name, nil
+}
+
+// streamError returns the error used when a stream can't be created, or
+// bound.
+func (j *JetStream) streamError(err error, name string) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrJetStreamStream).
+		NewFailedToError(
+			customerror.WithError(err),
+			customerror.WithField("stream", name),
+		)
+}
+
+// consumer creates, or binds the durable consumer of `s`, named from its
+// queue, returning its stream, and name.
+func (j *JetStream) consumer(s *subscription.Subscription) (string, string, error) {
+	stream, err := j.stream(s.Topic)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := durable(s.Queue)
+
+	if _, err := j.JS.ConsumerInfo(stream, name); err != nil {
+		if !errors.Is(err, natsgo.ErrConsumerNotFound) {
+			return "", "", j.consumerError(err, s, name)
+		}
+
+		// Consumers created concurrently, with the same configuration, are
+		// the same. Messages exhausting their attempts are dead-lettered, so
+		// not redelivered anymore.
+		maxDeliver := s.MaxAttempts
+
+		if maxDeliver <= 0 {
+			maxDeliver = DefaultMaxDeliver
+		}
+
+		if _, err := j.JS.AddConsumer(stream, &natsgo.ConsumerConfig{
+			Durable:        name,
+			DeliverSubject: natsgo.NewInbox(),
+			DeliverGroup:   name,
+			DeliverPolicy:  natsgo.DeliverAllPolicy,
+			AckPolicy:      natsgo.AckExplicitPolicy,
+			FilterSubject:  s.Topic,
+			MaxDeliver:     maxDeliver,
+		}); err != nil {
+			return "", "", j.consumerError(err, s, name)
+		}
+	}
+
+	return stream, name, nil
+}
+
+// consumerError returns the error used when a consumer can't be created, or
+// bound.
+func (j *JetStream) consumerError(err error, s *subscription.Subscription, name string) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrJetStreamConsumer).
+		NewFailedToError(
+			customerror.WithError(err),
+			customerror.WithField("topic", s.Topic),
+			customerror.WithField("consumer", name),
+		)
+}
+
+// publish encodes, and publishes `msg`, waiting for the broker ack.
+func (j *JetStream) publish(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+	e, err := j.Encode(ctx, msg, o)
+	if err != nil {
+		return msg, err
+	}
+
+	msg = e.Message
+
+	// Lets the broker deduplicate publishes of the same message, e.g.: retries,
+	// see `pubsub.WithContentID`.
+	e.Headers[natsgo.MsgIdHdr] = msg.ID
+
+	if err := j.Protect(ctx, func(ctx context.Context) error {
+		return j.send(ctx, msg.Topic, e)
+	}); err != nil {
+		return msg, err
+	}
+
+	return msg, nil
+}
+
+// send publishes `e`, as is, to `topic`, waiting for the broker ack.
+func (j *JetStream) send(ctx context.Context, topic string, e *pubsub.Envelope) error {
+	if _, err := j.stream(topic); err != nil {
+		return err
+	}
+
+	if _, err := j.JS.PublishMsg(&natsgo.Msg{
+		Subject: topic,
+		Data:    e.Payload,
+		Header:  natsutil.ToHeader(e.Headers),
+	}, natsgo.Context(ctx)); err != nil {
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrJetStreamPublish).
+			NewFailedToError(
+				customerror.WithError(err),
+				customerror.WithField("topic", topic),
+			)
+	}
+
+	return nil
+}
+
+//////
+// Implements the message.Acker interface.
+//////
+
+// Ack acknowledges the message was handled.
+func (a *acker) Ack(ctx context.Context) error {
+	return a.m.AckSync(natsgo.Context(ctx))
+}
+
+// Nack signals the message handling failed, so it's redelivered after `delay`.
+func (a *acker) Nack(ctx context.Context, delay time.Duration) error {
+	return a.m.NakWithDelay(delay, natsgo.Context(ctx))
+}
+
+// InProgress signals the message is still being handled, postponing its
+// redelivery.
+func (a *acker) InProgress(ctx context.Context) error {
+	return a.m.InProgress(natsgo.Context(ctx))
+}
+
+// Term signals the message can't be handled, so it's never redelivered.
+func (a *acker) Term(ctx context.Context) error {
+	return a.m.Term(natsgo.Context(ctx))
+}
+
+//////
+// Implement the PubSubClient interface.
+//////
+
+// Publish sends a message to a topic, waiting for the broker ack. The stream
+// of the topic family is created, or bound, if needed. Requests, see
+// `pubsub.WithSync`, aren't supported.
+func (j *JetStream) Publish(
+	ctx context.Context,
+	messages []*message.Message,
+	opts ...pubsub.Func,
+) ([]*message.Message, concurrentloop.Errors) {
+	//////
+	// APM Tracing.
+	//////
+
+	ctx, span := customapm.Trace(
+		ctx,
+		j.GetType(),
+		Name,
+		status.Published.String(),
+	)
+	defer span.End()
+
+	//////
+	// Publish.
+	//////
+
+	r, err := concurrentloop.Map(
+		ctx, messages,
+		func(ctx context.Context, message *message.Message) (*message.Message, error) {
+			if err := validation.Validate(message); err != nil {
+				return message, err
+			}
+
+			//////
+			// Process options.
+			//////
+
+			o, err := pubsub.NewOptions()
+			if err != nil {
+				return message, err
+			}
+
+			for _, opt := range opts {
+				if err := opt(o); err != nil {
+					return message, err
+				}
+			}
+
+			if o.Sync {
+				return message, errorcatalog.
+					Get().
+					MustGet(errorcatalog.PubSubErrJetStreamRequest).
+					NewFailedToError(
+						customerror.WithField("topic", message.Topic),
+						customerror.WithField("id", message.ID),
+					)
+			}
+
+			return j.Publishing(j.publish)(ctx, message, o)
+		})
+	if err != nil {
+		_ = customapm.TraceError(ctx, err, j.GetLogger(), j.GetPublishedFailedCounter())
+
+		return nil, err
+	}
+
+	//////
+	// Logging
+	//////
+
+	// Correlates the transaction, span and log, and logs it.
+	j.GetLogger().PrintlnWithOptions(
+		level.Debug,
+		status.Published.String(),
+		sypl.WithFields(logging.ToAPM(ctx, make(fields.Fields))),
+	)
+
+	//////
+	// Metrics.
+	//////
+
+	j.GetPublishedCounter().Add(1)
+
+	return r, nil
+}
+
+// MustPublish sends a message to a topic. In case of error it will panic.
+func (j *JetStream) MustPublish(ctx context.Context, msgs ...*message.Message) []*message.Message {
+	messages, err := j.Publish(ctx, msgs)
+	if err != nil {
+		panic(err)
+	}
+
+	return messages
+}
+
+// MustPublishAsync sends a message to a topic asynchronously. In case of error
+// it will panic.
+func (j *JetStream) MustPublishAsync(ctx context.Context, messages ...*message.Message) {
+	go j.MustPublish(ctx, messages...)
+}
+
+// Subscribe to a topic, with the durable consumer named from the subscription
+// queue. Subscriptions sharing a queue compete for messages. Messages are
+// acknowledged according to the subscription ack mode, see
+// `subscription.WithManualAck`: by default, messages which handling failed are
+// redelivered by the broker.
+func (j *JetStream) Subscribe(
+	ctx context.Context,
+	subscriptions []*subscription.Subscription,
+	opts ...pubsub.Func,
+) ([]*subscription.Subscription, concurrentloop.Errors) {
+	//////
+	// APM Tracing.
+	//////
+
+	ctx, span := customapm.Trace(
+		ctx,
+		j.GetType(),
+		Name,
+		status.Subscribed.String(),
+	)
+	defer span.End()
+
+	//////
+	// Subscribe.
+	//////
+
+	r, err := concurrentloop.Map(
+		ctx,
+		subscriptions,
+		func(ctx context.Context, subscription *subscription.Subscription) (*subscription.Subscription, error) {
+			if err := validation.Validate(subscription); err != nil {
+				return subscription, err
+			}
+
+			if err := subscription.CanSubscribe(); err != nil {
+				return subscription, err
+			}
+
+			//////
+			// Process options.
+			//////
+
+			o, err := pubsub.NewOptions()
+			if err != nil {
+				return subscription, err
+			}
+
+			for _, opt := range opts {
+				if err := opt(o); err != nil {
+					return subscription, err
+				}
+			}
+
+			stream, consumer, err := j.consumer(subscription)
+			if err != nil {
+				return subscription, err
+			}
+
+			// Subscribing twice is a no-op.
+			j.mu.Lock()
+			_, subscribed := j.handles[subscription]
+			j.mu.Unlock()
+
+			if subscribed {
+				return subscription, nil
+			}
+
+			// Deliveries outlive the subscribe operation, hence their own
+			// context, cancelled once unsubscribed.
+			deliveriesCtx, cancel := context.WithCancel(context.Background())
+
+			h := natsutil.NewHandle(cancel)
+
+			if o.Sync {
+				h.Subscription, err = j.JS.QueueSubscribeSync(
+					subscription.Topic,
+					consumer,
+					natsgo.Bind(stream, consumer),
+					natsgo.ManualAck(),
+				)
+			} else {
+				h.Subscription, err = j.JS.QueueSubscribe(subscription.Topic, consumer, func(m *natsgo.Msg) {
+					if !h.Deliver(func() {
+						// Acknowledged according to the subscription ack mode.
+						_ = j.Receive(deliveriesCtx, subscription, toEnvelope(m))
+					}) {
+						// Stopped, handed back to the other consumers.
+						_ = m.Nak()
+					}
+				}, natsgo.Bind(stream, consumer), natsgo.ManualAck())
+			}
+			if err != nil {
+				cancel()
+
+				if subscription.Channel != nil {
+					close(subscription.Channel)
+
+					subscription.Channel = nil
+				}
+
+				return subscription, errorcatalog.
+					Get().
+					MustGet(errorcatalog.PubSubErrJetStreamSubscribe).
+					NewFailedToError(
+						customerror.WithError(err),
+						customerror.WithField("topic", subscription.Topic),
+						customerror.WithField("id", subscription.ID),
+					)
+			}
+
+			j.mu.Lock()
+			_, subscribed = j.handles[subscription]
+
+			if !subscribed {
+				j.handles[subscription] = h
+			}
+			j.mu.Unlock()
+
+			// Subscribed concurrently, meanwhile.
+			if subscribed {
+				cancel()
+
+				_ = h.Unsubscribe()
+
+				return subscription, nil
+			}
+
+			if o.Sync {
+				subscription.SetNext(func(ctx context.Context) (*message.Message, error) {
+					return j.Pull(ctx, subscription, func(ctx context.Context) (*pubsub.Envelope, error) {
+						return h.Pull(ctx, subscription, errorcatalog.PubSubErrJetStreamNext, toEnvelope)
+					})
+				})
+			}
+
+			subscription.Status = status.Subscribed
+
+			return subscription, nil
+		})
+	if err != nil {
+		_ = customapm.TraceError(ctx, err, j.GetLogger(), j.GetSubscribedFailedCounter())
+
+		return nil, err
+	}
+
+	//////
+	// Logging
+	//////
+
+	// Correlates the transaction, span and log, and logs it.
+	j.GetLogger().PrintlnWithOptions(
+		level.Debug,
+		status.Subscribed.String(),
+		sypl.WithFields(logging.ToAPM(ctx, make(fields.Fields))),
+	)
+
+	//////
+	// Metrics.
+	//////
+
+	j.GetSubscribedCounter().Add(1)
+
+	return r, nil
+}
+
+// MustSubscribe to a topic. In case of error it will panic.
+func (j *JetStream) MustSubscribe(ctx context.Context, subscriptions ...*subscription.Subscription) []*subscription.Subscription {
+	subscriptions, err := j.Subscribe(ctx, subscriptions)
+	if err != nil {
+		panic(err)
+	}
+
+	return subscriptions
+}
+
+// MustSubscribeAsync to a topic asynchronously. In case of error it will panic.
+func (j *JetStream) MustSubscribeAsync(ctx context.Context, subscriptions ...*subscription.Subscription) {
+	go j.MustSubscribe(ctx, subscriptions...)
+}
+
+// Unsubscribe from a topic. It stops the delivery, and closes the subscription
+// channel, once the in-flight delivery is done, so handlers can unsubscribe
+// their own subscription. Unsubscribed subscriptions can't be subscribed again.
+// The durable consumer is kept.
+func (j *JetStream) Unsubscribe(ctx context.Context, subscriptions ...*subscription.Subscription) error {
+	var errs concurrentloop.Errors
+
+	for _, s := range subscriptions {
+		j.mu.Lock()
+		h, ok := j.handles[s]
+		delete(j.handles, s)
+		j.mu.Unlock()
+
+		if !ok {
+			errs = append(errs, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrSubscriptionNotFound).
+				NewFailedToError(
+					customerror.WithField("topic", s.Topic),
+					customerror.WithField("id", s.ID),
+				))
+
+			continue
+		}
+
+		if err := h.Stop(s); err != nil {
+			errs = append(errs, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrJetStreamUnsubscribe).
+				NewFailedToError(
+					customerror.WithError(err),
+					customerror.WithField("topic", s.Topic),
+					customerror.WithField("id", s.ID),
+				))
+		}
+	}
+
+	if errs != nil {
+		return customapm.TraceError(ctx, errs, j.GetLogger(), nil)
+	}
+
+	return nil
+}
+
+// Close the connection to the Pub Sub broker, unsubscribing all subscriptions.
+func (j *JetStream) Close() error {
+	j.mu.Lock()
+	handles := j.handles
+	j.handles = map[*subscription.Subscription]*natsutil.Handle{}
+	j.mu.Unlock()
+
+	for s, h := range handles {
+		_ = h.Stop(s)
+	}
+
+	j.Client.Close()
+
+	return nil
+}
+
+// GetClient returns the storage client. Use that to interact with the
+// underlying storage client.
+func (j *JetStream) GetClient() any {
+	return j.Client
+}
+
+//////
+// Factory.
+//////
+
+// New creates a new JetStream pubsub.
+func New(ctx context.Context, url string, options ...Option) (pubsub.IPubSub, error) {
+	var _ pubsub.IPubSub = (*JetStream)(nil)
+
+	p, err := pubsub.New(ctx, Name)
+	if err != nil {
+		return nil, err
+	}
+
+	natsConn, err := natsgo.Connect(url, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := retrier.New(retrier.ExponentialBackoff(3, 10*time.Second), nil)
+
+	if err := r.Run(func() error {
+		if err := natsConn.Flush(); err != nil {
+			return customerror.NewFailedToError("ping", customerror.WithError(err))
+		}
+
+		return nil
+	}); err != nil {
+		return nil, customapm.TraceError(ctx, err, p.GetLogger(), p.GetCounterPingFailed())
+	}
+
+	js, err := natsConn.JetStream()
+	if err != nil {
+		natsConn.Close()
+
+		return nil, customapm.TraceError(ctx, err, p.GetLogger(), nil)
+	}
+
+	client := &JetStream{
+		PubSub: p,
+
+		Client:  natsConn,
+		JS:      js,
+		Options: options,
+		Stream: natsgo.StreamConfig{
+			Storage:  natsgo.FileStorage,
+			Replicas: 1,
+		},
+		URL: url,
+
+		handles: map[*subscription.Subscription]*natsutil.Handle{},
+		streams: map[string]bool{},
+	}
+
+	// Routes messages, e.g.: to poison topics. They're persisted too.
+	p.Sender = client.send
+
+	singleton = client
+
+	return client, nil
+}
+
+//////
+// Exported functionalities.
+//////
+
+// StreamName returns the name of the stream of `topic` family, e.g.:
+// "V1_META" for "v1.meta.created". The stream holds all the family topics,
+// e.g.: "v1.meta.>", including their poison, and dead letter topics.
+func StreamName(topic string) string {
+	return strings.ToUpper(strings.ReplaceAll(family(topic), ".", "_"))
+}
+
+// Get returns a setup JetStream, or set it up.
+func Get() pubsub.IPubSub {
+	if singleton == nil {
+		panic(errorcatalog.Get().MustGet(errorcatalog.PubSubErrJetStreamNilMessage).NewFailedToError())
+	}
+
+	return singleton
+}
+
+// Set sets the singleton. Useful for testing.
+func Set(ps pubsub.IPubSub) {
+	singleton = ps
+}
@@ -0,0 +1,487 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/thalesfsp/status"
+)
+
+// runServer runs an embedded nats-server, with JetStream enabled, returning
+// its URL.
+func runServer(t *testing.T) string {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	assert.NoError(t, err)
+
+	go s.Start()
+
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats-server isn't ready")
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	return s.ClientURL()
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+	assert.NotNil(t, client.GetClient())
+
+	defer client.Close()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", func(msg *message.Message) {
+		defer wg.Done()
+
+		var v shared.TestDataS
+
+		assert.NoError(t, msg.Process(msg.Data, &v))
+		assert.Equal(t, shared.TestData, &v)
+		assert.Equal(t, shared.DocumentID, msg.GetHeader("Correlation-Id"))
+	})
+
+	client.MustSubscribe(ctx, sub)
+
+	msg := message.MustNew(sub.Topic, shared.TestData)
+	msg.SetHeader("Correlation-Id", shared.DocumentID)
+
+	client.MustPublish(ctx, msg)
+
+	wg.Wait()
+
+	// The stream of the topic family is created.
+	info, err := client.(*JetStream).JS.StreamInfo(StreamName(sub.Topic))
+	assert.NoError(t, err)
+	assert.Equal(t, "V1_META", info.Config.Name)
+	assert.Equal(t, []string{"v1.meta.>"}, info.Config.Subjects)
+
+	assert.Equal(t, int64(1), client.GetPublishedCounter().Value())
+	assert.Equal(t, int64(0), client.GetPublishedFailedCounter().Value())
+	assert.Equal(t, int64(1), client.GetSubscribedCounter().Value())
+	assert.Equal(t, int64(0), client.GetSubscribedFailedCounter().Value())
+
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+	// Unsubscribing twice should fail.
+	assert.Error(t, client.Unsubscribe(ctx, sub))
+
+	// Subscribing again fails, its channel would be closed.
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub})
+	assert.NotEmpty(t, errs)
+
+	// Requests aren't supported.
+	_, errs = client.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithSync(true))
+	assert.NotEmpty(t, errs)
+}
+
+func TestJetStream_durable(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.updated", "v1.meta.updated.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	msg, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, msg.Ack(ctx))
+
+	// Consumer is down.
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+	client.MustPublish(
+		ctx,
+		message.MustNew(sub.Topic, shared.TestData),
+		message.MustNew(sub.Topic, shared.TestData),
+	)
+
+	// Back, with the same queue, so the same durable consumer: nothing is
+	// lost, nor delivered twice.
+	resumed := subscription.MustNew(sub.Topic, sub.Queue, nil)
+
+	_, errs = client.Subscribe(ctx, []*subscription.Subscription{resumed}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	msgs, err := resumed.Fetch(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+
+	for _, msg := range msgs {
+		assert.NoError(t, msg.Ack(ctx))
+	}
+
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer fetchCancel()
+
+	_, err = resumed.Next(fetchCtx)
+	assert.Error(t, err)
+}
+
+func TestJetStream_pull(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.pulled", "v1.meta.pulled.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	// JetStream has its own subscriptions too, e.g.: for replies.
+	conn := client.(*JetStream).Client
+	subscribed := conn.NumSubscriptions()
+
+	// Subscribing twice is a no-op.
+	_, errs = client.Subscribe(ctx, []*subscription.Subscription{sub, sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+	assert.Equal(t, subscribed, conn.NumSubscriptions())
+
+	published := client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// Not acknowledged automatically, so the caller failing to handle it
+	// doesn't lose it.
+	msg, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, published[0].ID, msg.ID)
+	assert.Equal(t, int64(0), client.GetAckedCounter().Value())
+
+	assert.NoError(t, msg.Nack(ctx, 0))
+
+	// Redelivered, until acknowledged.
+	msg, err = sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, published[0].ID, msg.ID)
+	assert.NoError(t, msg.Ack(ctx))
+
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer fetchCancel()
+
+	_, err = sub.Next(fetchCtx)
+	assert.Error(t, err)
+
+	assert.Equal(t, int64(1), client.GetAckedCounter().Value())
+	assert.Equal(t, int64(1), client.GetNackedCounter().Value())
+
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+	assert.Equal(t, subscribed-1, conn.NumSubscriptions())
+}
+
+func TestJetStream_redelivery(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var (
+		attempts atomic.Int32
+		wg       sync.WaitGroup
+	)
+
+	wg.Add(2)
+
+	// Fails once, then succeeds.
+	sub := subscription.MustNewWithHandler("v1.meta.deleted", "v1.meta.deleted.queue", func(ctx context.Context, msg *message.Message) error {
+		defer wg.Done()
+
+		if attempts.Add(1) == 1 {
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+
+	client.MustSubscribe(ctx, sub)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	wg.Wait()
+
+	// Nacked, then acked once handled.
+	assert.Eventually(t, func() bool {
+		return client.GetAckedCounter().Value() == 1
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, int64(1), client.GetNackedCounter().Value())
+	assert.Equal(t, int64(1), client.GetSubscribedFailedCounter().Value())
+}
+
+func TestJetStream_maxDeliver(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	client.(*JetStream).RedeliveryDelay = 10 * time.Millisecond
+
+	var attempts atomic.Int32
+
+	// Always fails, without a max attempts count.
+	sub := subscription.MustNewWithHandler("v1.meta.poison", "v1.meta.poison.queue", func(ctx context.Context, msg *message.Message) error {
+		attempts.Add(1)
+
+		return errors.New("failed")
+	})
+
+	client.MustSubscribe(ctx, sub)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// Redelivered after the delay, up to the default bound.
+	assert.Eventually(t, func() bool {
+		return attempts.Load() == DefaultMaxDeliver
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	time.Sleep(200 * time.Millisecond)
+
+	assert.Equal(t, int32(DefaultMaxDeliver), attempts.Load())
+	assert.Equal(t, int64(DefaultMaxDeliver), client.GetNackedCounter().Value())
+}
+
+func TestJetStream_ack(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var (
+		attempts atomic.Int32
+		wg       sync.WaitGroup
+	)
+
+	wg.Add(3)
+
+	// Manually acknowledged: in progress, then nacked, then acked.
+	acked := subscription.MustNewWithHandler("v1.meta.acked", "v1.meta.acked.queue", func(ctx context.Context, msg *message.Message) error {
+		defer wg.Done()
+
+		if attempts.Add(1) == 1 {
+			assert.NoError(t, msg.InProgress(ctx))
+
+			return msg.Nack(ctx, 10*time.Millisecond)
+		}
+
+		return msg.Ack(ctx)
+	}, subscription.WithManualAck())
+
+	assert.Equal(t, subscription.AckManual, acked.AckMode)
+
+	// Terminated, never redelivered, even if the handler fails.
+	terminated := subscription.MustNewWithHandler("v1.meta.terminated", "v1.meta.terminated.queue", func(ctx context.Context, msg *message.Message) error {
+		defer wg.Done()
+
+		assert.NoError(t, msg.Term(ctx))
+
+		return errors.New("failed")
+	})
+
+	assert.Equal(t, subscription.AckAuto, terminated.AckMode)
+
+	client.MustSubscribe(ctx, acked, terminated)
+
+	client.MustPublish(
+		ctx,
+		message.MustNew(acked.Topic, shared.TestData),
+		message.MustNew(terminated.Topic, shared.TestData),
+	)
+
+	wg.Wait()
+
+	// Undecodable, so terminated.
+	assert.NoError(t, client.(*JetStream).send(ctx, terminated.Topic, &pubsub.Envelope{Payload: []byte("{")}))
+
+	assert.Eventually(t, func() bool {
+		return client.GetTerminatedCounter().Value() == 2
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, int64(1), client.GetAckedCounter().Value())
+	assert.Equal(t, int64(1), client.GetNackedCounter().Value())
+	assert.Equal(t, int64(1), client.GetInProgressCounter().Value())
+}
+
+func TestJetStream_deadLetter(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var attempts atomic.Int32
+
+	// Always fails, redelivered by the broker, then dead-lettered.
+	sub := subscription.MustNewWithHandler("v1.meta.failed", "v1.meta.failed.queue", func(ctx context.Context, msg *message.Message) error {
+		attempts.Add(1)
+
+		return errors.New("failed")
+	}, subscription.WithDeadLetter(2, ""))
+
+	dlq := subscription.MustNew(sub.DeadLetterTopic, "v1.meta.dlq.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{dlq}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustSubscribe(ctx, sub)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	msg, err := dlq.Next(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, msg.Ack(ctx))
+	assert.Equal(t, sub.Topic, msg.GetHeader(pubsub.HeaderTopic))
+	assert.Equal(t, "2", msg.GetHeader(pubsub.HeaderAttempts))
+	assert.Contains(t, msg.GetHeader(pubsub.HeaderError), "failed")
+	assert.NotEmpty(t, msg.GetHeader(pubsub.HeaderFailedAt))
+
+	// Nacked once, then acked once dead-lettered, so not redelivered.
+	assert.Eventually(t, func() bool {
+		return client.GetAckedCounter().Value() == 2
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, int64(1), client.GetNackedCounter().Value())
+	assert.Equal(t, int64(1), client.GetDeadLetteredCounter().Value())
+}
+
+func TestJetStream_contentID(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.identified", "v1.meta.identified.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	// Retries of the same logical event are deduplicated by the broker.
+	var published []*message.Message
+
+	for i := 0; i < 2; i++ {
+		msgs, errs := client.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithContentID())
+		assert.Empty(t, errs)
+
+		published = append(published, msgs...)
+	}
+
+	assert.Equal(t, published[0].ID, published[1].ID)
+
+	msg, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, msg.Ack(ctx))
+	assert.Equal(t, published[0].ID, msg.ID)
+	assert.Empty(t, msg.GetHeader(natsgo.MsgIdHdr))
+
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer fetchCancel()
+
+	_, err = sub.Next(fetchCtx)
+	assert.Error(t, err)
+}
+
+func TestJetStream_selfUnsubscribe(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, runServer(t))
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	unsubscribed := make(chan error, 1)
+
+	var sub *subscription.Subscription
+
+	sub = subscription.MustNew("v1.meta.deleted", "v1.meta.deleted.queue", func(msg *message.Message) {
+		unsubscribed <- client.Unsubscribe(ctx, sub)
+	}, subscription.WithChannel(1, subscription.OverflowDropNewest))
+
+	client.MustSubscribe(ctx, sub)
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// Handlers can unsubscribe their own subscription, without deadlocking.
+	select {
+	case err := <-unsubscribed:
+		assert.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("unsubscribing from the handler deadlocked")
+	}
+
+	// The channel is closed once the delivery is done.
+	for range sub.Channel {
+	}
+
+	assert.Equal(t, status.Stopped, sub.Status)
+}
@@ -0,0 +1,3 @@
+// Package memory provides an in-process implementation of the pubsub
+// interface. It's suitable for tests, and single-process applications.
+package memory
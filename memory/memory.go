@@ -0,0 +1,646 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/thalesfsp/concurrentloop"
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/status"
+	"github.com/thalesfsp/sypl"
+	"github.com/thalesfsp/sypl/fields"
+	"github.com/thalesfsp/sypl/level"
+	"github.com/thalesfsp/validation"
+)
+
+//////
+// Const, vars, and types.
+//////
+
+// Name is the name of the pubsub.
+const Name = "memory"
+
+// DefaultBufferSize is the default amount of messages a subscription holds
+// before publishing to it blocks.
+const DefaultBufferSize = 1024
+
+// Singleton.
+var singleton pubsub.IPubSub
+
+// consumer is a registered subscription, and its delivery machinery.
+type consumer struct {
+	// subscription is the user-provided subscription.
+	subscription *subscription.Subscription
+
+	// inbox holds messages waiting to be delivered.
+	inbox chan *pubsub.Envelope
+
+	// done is closed once the consumer is stopped.
+	done <-chan struct{}
+
+	// cancel stops the consumer.
+	cancel context.CancelFunc
+
+	// sync is true for synchronous subscriptions, which are pulled, not run.
+	sync bool
+}
+
+// Memory pubsub definition.
+type Memory struct {
+	*pubsub.PubSub
+
+	// BufferSize is the amount of messages a subscription holds before
+	// publishing to it blocks.
+	BufferSize int `json:"bufferSize" validate:"gt=0"`
+
+	// RequestTimeout bounds the wait for a reply, when publishing with
+	// `WithSync`, and `ctx` has no deadline.
+	RequestTimeout time.Duration `json:"requestTimeout" validate:"gt=0"`
+
+	// mu guards the fields below.
+	mu sync.RWMutex
+
+	// closed is true once `Close` is called.
+	closed bool
+
+	// consumers are the registered subscriptions, in subscription order.
+	consumers []*consumer
+
+	// next is the round-robin position per topic, and queue.
+	next map[string]int
+}
+
+//////
+// Helpers.
+//////
+
+// targets selects the consumers which should receive a message published to
+// `topic`. Subscriptions without a queue always receive it. Subscriptions
+// sharing a queue compete for it, only one of them (round-robin) receives it.
+func (m *Memory) targets(topic string) []*consumer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := map[string][]*consumer{}
+	order := []string{}
+
+	targets := []*consumer{}
+
+	for _, c := range m.consumers {
+		if c.subscription.Topic != topic {
+			continue
+		}
+
+		if c.subscription.Queue == "" {
+			targets = append(targets, c)
+
+			continue
+		}
+
+		if _, ok := groups[c.subscription.Queue]; !ok {
+			order = append(order, c.subscription.Queue)
+		}
+
+		groups[c.subscription.Queue] = append(groups[c.subscription.Queue], c)
+	}
+
+	for _, queue := range order {
+		key := topic + "|" + queue
+
+		members := groups[queue]
+
+		targets = append(targets, members[m.next[key]%len(members)])
+
+		m.next[key]++
+	}
+
+	return targets
+}
+
+// pull pulls the next envelope of a synchronous subscription.
+func (m *Memory) pull(ctx context.Context, c *consumer) (*pubsub.Envelope, error) {
+	select {
+	case e := <-c.inbox:
+		return e, nil
+	case <-c.done:
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSubscriptionStopped).
+			NewFailedToError(
+				customerror.WithField("topic", c.subscription.Topic),
+				customerror.WithField("id", c.subscription.ID),
+			)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run delivers messages until the consumer is stopped, then closes the
+// subscription channel.
+func (m *Memory) run(ctx context.Context, c *consumer) {
+	defer m.release(c)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case e := <-c.inbox:
+			// Stopped meanwhile.
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Failures are only reported, there's no redelivery.
+			_ = m.Receive(ctx, c.subscription, e)
+		}
+	}
+}
+
+// release closes the subscription channel, if any.
+func (m *Memory) release(c *consumer) {
+	if c.subscription.Channel != nil {
+		close(c.subscription.Channel)
+	}
+}
+
+// stop stops the consumer. It doesn't wait for the in-flight delivery, so
+// handlers can unsubscribe their own subscription: the subscription channel is
+// closed once it's done. Stopped subscriptions can't be subscribed again.
+func (m *Memory) stop(c *consumer) {
+	c.cancel()
+
+	c.subscription.Status = status.Stopped
+
+	// Synchronous subscriptions aren't run, nothing in flight.
+	if c.sync {
+		m.release(c)
+	}
+}
+
+// remove unregisters `s`, returning its consumer, if any.
+func (m *Memory) remove(s *subscription.Subscription) *consumer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.consumers {
+		if c.subscription == s {
+			m.consumers = append(m.consumers[:i], m.consumers[i+1:]...)
+
+			return c
+		}
+	}
+
+	return nil
+}
+
+// send enqueues `e` to the subscriptions of `topic`, returning how many
+// received it.
+func (m *Memory) send(ctx context.Context, topic string, e *pubsub.Envelope) (int, error) {
+	m.mu.RLock()
+	closed := m.closed
+	m.mu.RUnlock()
+
+	if closed {
+		return 0, m.closedError(topic, "")
+	}
+
+	// Received from the topic it's sent to, like with a broker.
+	if e.Topic != topic {
+		sent := *e
+		sent.Topic = topic
+		e = &sent
+	}
+
+	targets := m.targets(topic)
+
+	for _, c := range targets {
+		select {
+		case c.inbox <- e:
+		case <-c.done:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	return len(targets), nil
+}
+
+// publish delivers `msg` to the subscriptions of its topic. If `o.Sync`, it
+// waits for the first reply.
+func (m *Memory) publish(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+	e, err := m.Encode(ctx, msg, o)
+	if err != nil {
+		return msg, err
+	}
+
+	msg = e.Message
+
+	// Requests can be replied. The first reply wins, others are discarded.
+	replies := make(chan *pubsub.Envelope, 1)
+
+	if o.Sync {
+		e.Respond = func(ctx context.Context, reply *pubsub.Envelope) error {
+			select {
+			case replies <- reply:
+			default:
+			}
+
+			return nil
+		}
+	}
+
+	n, err := m.send(ctx, msg.Topic, e)
+	if err != nil {
+		return msg, err
+	}
+
+	if !o.Sync {
+		return msg, nil
+	}
+
+	noReplyErr := errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrPubSubNoReply).
+		NewFailedToError(
+			customerror.WithField("topic", msg.Topic),
+			customerror.WithField("id", msg.ID),
+		)
+
+	if n == 0 {
+		return msg, noReplyErr
+	}
+
+	// Without a deadline, a request no subscriber replies would wait forever.
+	wait := ctx
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		wait, cancel = context.WithTimeout(ctx, m.RequestTimeout)
+		defer cancel()
+	}
+
+	select {
+	case r := <-replies:
+		return m.DecodeReply(ctx, msg.Topic, r)
+	case <-wait.Done():
+		return msg, noReplyErr
+	}
+}
+
+// closedError returns the error used when operating a closed pubsub.
+func (m *Memory) closedError(topic, id string) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrMemoryClosed).
+		NewFailedToError(
+			customerror.WithField("topic", topic),
+			customerror.WithField("id", id),
+		)
+}
+
+//////
+// Implement the PubSubClient interface.
+//////
+
+// Publish sends a message to a topic.
+func (m *Memory) Publish(
+	ctx context.Context,
+	messages []*message.Message,
+	opts ...pubsub.Func,
+) ([]*message.Message, concurrentloop.Errors) {
+	//////
+	// APM Tracing.
+	//////
+
+	ctx, span := customapm.Trace(
+		ctx,
+		m.GetType(),
+		Name,
+		status.Published.String(),
+	)
+	defer span.End()
+
+	//////
+	// Publish.
+	//////
+
+	r, err := concurrentloop.Map(
+		ctx, messages,
+		func(ctx context.Context, message *message.Message) (*message.Message, error) {
+			if err := validation.Validate(message); err != nil {
+				return message, err
+			}
+
+			//////
+			// Process options.
+			//////
+
+			o, err := pubsub.NewOptions()
+			if err != nil {
+				return message, err
+			}
+
+			for _, opt := range opts {
+				if err := opt(o); err != nil {
+					return message, err
+				}
+			}
+
+			return m.Publishing(m.publish)(ctx, message, o)
+		})
+	if err != nil {
+		_ = customapm.TraceError(ctx, err, m.GetLogger(), m.GetPublishedFailedCounter())
+
+		return nil, err
+	}
+
+	//////
+	// Logging
+	//////
+
+	// Correlates the transaction, span and log, and logs it.
+	m.GetLogger().PrintlnWithOptions(
+		level.Debug,
+		status.Published.String(),
+		sypl.WithFields(logging.ToAPM(ctx, make(fields.Fields))),
+	)
+
+	//////
+	// Metrics.
+	//////
+
+	m.GetPublishedCounter().Add(1)
+
+	return r, nil
+}
+
+// MustPublish sends a message to a topic. In case of error it will panic.
+func (m *Memory) MustPublish(ctx context.Context, msgs ...*message.Message) []*message.Message {
+	messages, err := m.Publish(ctx, msgs)
+	if err != nil {
+		panic(err)
+	}
+
+	return messages
+}
+
+// MustPublishAsync sends a message to a topic asynchronously. In case of error
+// it will panic.
+func (m *Memory) MustPublishAsync(ctx context.Context, messages ...*message.Message) {
+	go m.MustPublish(ctx, messages...)
+}
+
+// Subscribe to a topic.
+func (m *Memory) Subscribe(
+	ctx context.Context,
+	subscriptions []*subscription.Subscription,
+	opts ...pubsub.Func,
+) ([]*subscription.Subscription, concurrentloop.Errors) {
+	//////
+	// APM Tracing.
+	//////
+
+	ctx, span := customapm.Trace(
+		ctx,
+		m.GetType(),
+		Name,
+		status.Subscribed.String(),
+	)
+	defer span.End()
+
+	//////
+	// Subscribe.
+	//////
+
+	r, err := concurrentloop.Map(
+		ctx,
+		subscriptions,
+		func(ctx context.Context, subscription *subscription.Subscription) (*subscription.Subscription, error) {
+			if err := validation.Validate(subscription); err != nil {
+				return subscription, err
+			}
+
+			if err := subscription.CanSubscribe(); err != nil {
+				return subscription, err
+			}
+
+			//////
+			// Process options.
+			//////
+
+			o, err := pubsub.NewOptions()
+			if err != nil {
+				return subscription, err
+			}
+
+			for _, opt := range opts {
+				if err := opt(o); err != nil {
+					return subscription, err
+				}
+			}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if m.closed {
+				return subscription, m.closedError(subscription.Topic, subscription.ID)
+			}
+
+			// Subscribing twice is a no-op.
+			for _, c := range m.consumers {
+				if c.subscription == subscription {
+					return subscription, nil
+				}
+			}
+
+			// Delivery outlives the subscribe operation, hence its own context,
+			// cancelled once stopped.
+			deliveriesCtx, cancel := context.WithCancel(context.Background())
+
+			c := &consumer{
+				subscription: subscription,
+				inbox:        make(chan *pubsub.Envelope, m.BufferSize),
+				done:         deliveriesCtx.Done(),
+				cancel:       cancel,
+				sync:         o.Sync,
+			}
+
+			m.consumers = append(m.consumers, c)
+
+			subscription.Status = status.Subscribed
+
+			// Synchronous subscriptions are pulled, nothing to run.
+			if o.Sync {
+				subscription.SetNext(func(ctx context.Context) (*message.Message, error) {
+					return m.Pull(ctx, c.subscription, func(ctx context.Context) (*pubsub.Envelope, error) {
+						return m.pull(ctx, c)
+					})
+				})
+
+				return subscription, nil
+			}
+
+			go m.run(deliveriesCtx, c)
+
+			return subscription, nil
+		})
+	if err != nil {
+		_ = customapm.TraceError(ctx, err, m.GetLogger(), m.GetSubscribedFailedCounter())
+
+		return nil, err
+	}
+
+	//////
+	// Logging
+	//////
+
+	// Correlates the transaction, span and log, and logs it.
+	m.GetLogger().PrintlnWithOptions(
+		level.Debug,
+		status.Subscribed.String(),
+		sypl.WithFields(logging.ToAPM(ctx, make(fields.Fields))),
+	)
+
+	//////
+	// Metrics.
+	//////
+
+	m.GetSubscribedCounter().Add(1)
+
+	return r, nil
+}
+
+// MustSubscribe to a topic. In case of error it will panic.
+func (m *Memory) MustSubscribe(ctx context.Context, subscriptions ...*subscription.Subscription) []*subscription.Subscription {
+	subscriptions, err := m.Subscribe(ctx, subscriptions)
+	if err != nil {
+		panic(err)
+	}
+
+	return subscriptions
+}
+
+// MustSubscribeAsync to a topic asynchronously. In case of error it will panic.
+func (m *Memory) MustSubscribeAsync(ctx context.Context, subscriptions ...*subscription.Subscription) {
+	go m.MustSubscribe(ctx, subscriptions...)
+}
+
+// Unsubscribe from a topic. It stops the delivery, and closes the subscription
+// channel, once the in-flight delivery is done, so handlers can unsubscribe
+// their own subscription. Unsubscribed subscriptions can't be subscribed again.
+func (m *Memory) Unsubscribe(ctx context.Context, subscriptions ...*subscription.Subscription) error {
+	var errs concurrentloop.Errors
+
+	for _, s := range subscriptions {
+		c := m.remove(s)
+		if c == nil {
+			errs = append(errs, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrSubscriptionNotFound).
+				NewFailedToError(
+					customerror.WithField("topic", s.Topic),
+					customerror.WithField("id", s.ID),
+				))
+
+			continue
+		}
+
+		m.stop(c)
+	}
+
+	if errs != nil {
+		return customapm.TraceError(ctx, errs, m.GetLogger(), nil)
+	}
+
+	return nil
+}
+
+// Close the pubsub, unsubscribing all subscriptions.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+
+	m.closed = true
+
+	consumers := m.consumers
+
+	m.consumers = nil
+
+	m.mu.Unlock()
+
+	for _, c := range consumers {
+		m.stop(c)
+	}
+
+	return nil
+}
+
+// GetClient returns the storage client. There's no underlying client, so it
+// returns itself.
+func (m *Memory) GetClient() any {
+	return m
+}
+
+//////
+// Factory.
+//////
+
+// New creates a new in-memory pubsub.
+func New(ctx context.Context) (pubsub.IPubSub, error) {
+	var _ pubsub.IPubSub = (*Memory)(nil)
+
+	p, err := pubsub.New(ctx, Name)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Memory{
+		PubSub: p,
+
+		BufferSize:     DefaultBufferSize,
+		RequestTimeout: shared.DefaultTimeout,
+
+		next: map[string]int{},
+	}
+
+	if err := validation.Validate(client); err != nil {
+		return nil, customapm.TraceError(ctx, err, p.GetLogger(), nil)
+	}
+
+	// Routes messages, e.g.: to poison topics.
+	p.Sender = func(ctx context.Context, topic string, e *pubsub.Envelope) error {
+		_, err := client.send(ctx, topic, e)
+
+		return err
+	}
+
+	singleton = client
+
+	return client, nil
+}
+
+//////
+// Exported functionalities.
+//////
+
+// Get returns a setup in-memory pubsub, or set it up.
+func Get() pubsub.IPubSub {
+	if singleton == nil {
+		panic(errorcatalog.Get().MustGet(errorcatalog.PubSubErrMemoryNilMessage).NewFailedToError())
+	}
+
+	return singleton
+}
+
+// Set sets the singleton. Useful for testing.
+func Set(ps pubsub.IPubSub) {
+	singleton = ps
+}
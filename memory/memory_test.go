@@ -0,0 +1,1330 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
+	"github.com/WreckingBallStudioLabs/pubsub/codec"
+	"github.com/WreckingBallStudioLabs/pubsub/compression"
+	"github.com/WreckingBallStudioLabs/pubsub/dedup"
+	"github.com/WreckingBallStudioLabs/pubsub/encryption"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/signing"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/stretchr/testify/assert"
+	"github.com/thalesfsp/status"
+	"go.elastic.co/apm"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestNew(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	type args struct {
+		ctx context.Context
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Should work",
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//////
+			// Tear up.
+			//////
+
+			ctx, cancel := context.WithTimeout(tt.args.ctx, shared.DefaultTimeout)
+			defer cancel()
+
+			client, err := New(ctx)
+			assert.NoError(t, err)
+			assert.NotNil(t, client)
+
+			defer client.Close()
+
+			//////
+			// Should be able to subscribe to a channel.
+			//////
+
+			var wg sync.WaitGroup
+
+			wg.Add(2)
+
+			sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", func(msg *message.Message) {
+				defer wg.Done()
+
+				var v shared.TestDataS
+
+				if err := msg.Process(msg.Data, &v); err != nil {
+					t.Error(err)
+				}
+
+				assert.Equal(t, shared.TestData, &v)
+				assert.Equal(t, shared.DocumentID, msg.GetHeader("Correlation-Id"))
+
+				// Trace is propagated.
+				assert.NotEmpty(t, msg.GetHeader("traceparent"))
+			}, subscription.WithChannel(0, subscription.OverflowBlock))
+
+			go func() {
+				select {
+				case <-ctx.Done():
+				case msg := <-sub.Channel:
+					defer wg.Done()
+
+					var v shared.TestDataS
+
+					if err := msg.Process(msg.Data, &v); err != nil {
+						t.Error(err)
+					}
+
+					assert.Equal(t, shared.TestData, &v)
+				}
+			}()
+
+			assert.NotPanics(t, func() {
+				client.MustSubscribe(ctx, sub)
+			})
+
+			//////
+			// Should be able to publish to a channel.
+			//////
+
+			assert.NotPanics(t, func() {
+				msg := message.MustNew(sub.Topic, shared.TestData)
+
+				msg.SetHeader("Correlation-Id", shared.DocumentID)
+
+				client.MustPublish(ctx, msg)
+			})
+
+			wg.Wait()
+
+			// Should check if the metrics are working.
+			assert.Equal(t, int64(1), client.GetPublishedCounter().Value())
+			assert.Equal(t, int64(0), client.GetPublishedFailedCounter().Value())
+			assert.Equal(t, int64(1), client.GetSubscribedCounter().Value())
+			assert.Equal(t, int64(0), client.GetSubscribedFailedCounter().Value())
+
+			//////
+			// Should be able to unsubscribe.
+			//////
+
+			assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+			_, ok := <-sub.Channel
+			assert.False(t, ok)
+			assert.Equal(t, status.Stopped, sub.Status)
+
+			// Unsubscribing twice should fail.
+			assert.Error(t, client.Unsubscribe(ctx, sub))
+
+			// Subscribing again fails, its channel is closed.
+			_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub})
+			assert.NotEmpty(t, errs)
+
+			assert.NotPanics(t, func() {
+				client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+			})
+		})
+	}
+}
+
+func TestMemory_queue(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	const total = 10
+
+	var (
+		wg       sync.WaitGroup
+		received [3]int64
+	)
+
+	wg.Add(total * 2)
+
+	newSub := func(i int, queue string) *subscription.Subscription {
+		s := subscription.MustNew("v1.meta.created", queue, func(msg *message.Message) {
+			atomic.AddInt64(&received[i], 1)
+
+			wg.Done()
+		})
+
+		return s
+	}
+
+	// Two competing consumers, and one on its own queue.
+	client.MustSubscribe(
+		ctx,
+		newSub(0, "v1.meta.created.queue"),
+		newSub(1, "v1.meta.created.queue"),
+		newSub(2, "v1.meta.other.queue"),
+	)
+
+	for i := 0; i < total; i++ {
+		client.MustPublish(ctx, message.MustNew("v1.meta.created", shared.TestData))
+	}
+
+	wg.Wait()
+
+	// Each message is delivered once per queue.
+	assert.Equal(t, int64(total), atomic.LoadInt64(&received[0])+atomic.LoadInt64(&received[1]))
+	assert.Equal(t, int64(total), atomic.LoadInt64(&received[2]))
+	assert.NotZero(t, atomic.LoadInt64(&received[0]))
+	assert.NotZero(t, atomic.LoadInt64(&received[1]))
+}
+
+func TestMemory_request(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	// No subscriber, no reply.
+	_, errs := client.Publish(ctx, []*message.Message{message.MustNew("v1.meta.created", shared.TestData)}, pubsub.WithSync(true))
+	assert.NotEmpty(t, errs)
+
+	sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", func(msg *message.Message) {
+		assert.True(t, msg.IsRequest())
+		assert.NoError(t, msg.Respond(ctx, shared.UpdatedTestData))
+	})
+
+	client.MustSubscribe(ctx, sub)
+
+	replies, errs := client.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+	assert.Len(t, replies, 1)
+
+	var v shared.TestDataS
+
+	assert.NoError(t, replies[0].Process(replies[0].Data, &v))
+	assert.Equal(t, shared.UpdatedTestData, &v)
+
+	// Requests without a deadline, which no subscriber replies, time out.
+	client.(*Memory).RequestTimeout = 100 * time.Millisecond
+
+	client.MustSubscribe(ctx, subscription.MustNew("v1.meta.updated", "v1.meta.updated.queue", func(msg *message.Message) {}))
+
+	_, errs = client.Publish(context.Background(), []*message.Message{message.MustNew("v1.meta.updated", shared.TestData)}, pubsub.WithSync(true))
+	assert.NotEmpty(t, errs)
+}
+
+func TestMemory_sync(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustPublish(
+		ctx,
+		message.MustNew(sub.Topic, shared.TestData),
+		message.MustNew(sub.Topic, shared.TestData),
+		message.MustNew(sub.Topic, shared.TestData),
+	)
+
+	msgs, err := sub.Fetch(ctx, 3)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	// Nothing left to pull.
+	nextCtx, nextCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer nextCancel()
+
+	_, err = sub.Next(nextCtx)
+	assert.Error(t, err)
+
+	// Pulling from a stopped subscription fails.
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+	_, err = sub.Next(ctx)
+	assert.Error(t, err)
+}
+
+func TestMemory_handler(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	sub := subscription.MustNewWithHandler(
+		"v1.meta.created",
+		"v1.meta.created.queue",
+		func(ctx context.Context, msg *message.Message) error {
+			defer wg.Done()
+
+			// Carries the transaction, and the deadline.
+			assert.NotNil(t, apm.TransactionFromContext(ctx))
+
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+
+			if msg.GetHeader("Fail") != "" {
+				return errors.New("failed to process")
+			}
+
+			return nil
+		},
+		subscription.WithTimeout(time.Second),
+	)
+
+	client.MustSubscribe(ctx, sub)
+
+	failing := message.MustNew(sub.Topic, shared.TestData)
+
+	failing.SetHeader("Fail", "true")
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData), failing)
+
+	wg.Wait()
+
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+	// Failures are counted.
+	assert.Equal(t, int64(1), client.GetSubscribedFailedCounter().Value())
+}
+
+func TestMemory_decodeError(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	malformed := &pubsub.Envelope{
+		Headers: map[string]string{"Correlation-Id": shared.DocumentID},
+		Payload: []byte("{"),
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	// Hooked.
+	hooked := subscription.MustNew("v1.meta.hooked", "v1.meta.hooked.queue", nil, subscription.WithDecodeErrorHook(
+		func(ctx context.Context, payload []byte, headers map[string]string, err error) {
+			defer wg.Done()
+
+			assert.Equal(t, malformed.Payload, payload)
+			assert.Equal(t, shared.DocumentID, headers["Correlation-Id"])
+			assert.Error(t, err)
+		},
+	))
+
+	// Poisoned, routed as is, with the error, and the original topic.
+	poisoned := subscription.MustNew("v1.meta.poisoned", "v1.meta.poisoned.queue", nil, subscription.WithPoisonTopic(""))
+
+	assert.Equal(t, "v1.meta.poisoned.poison", poisoned.PoisonTopic)
+
+	quarantine := subscription.MustNew(poisoned.PoisonTopic, "v1.meta.quarantine.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{quarantine}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	// Dropped, the default.
+	dropped := subscription.MustNew("v1.meta.dropped", "v1.meta.dropped.queue", func(msg *message.Message) {
+		defer wg.Done()
+
+		// Only the valid message is delivered.
+		assert.Equal(t, "v1.meta.dropped", msg.Topic)
+	})
+
+	assert.Equal(t, subscription.DecodeErrorDrop, dropped.DecodeErrorPolicy)
+
+	client.MustSubscribe(ctx, hooked, poisoned, dropped)
+
+	m := client.(*Memory)
+
+	for _, topic := range []string{hooked.Topic, poisoned.Topic, dropped.Topic} {
+		_, err := m.send(ctx, topic, malformed)
+		assert.NoError(t, err)
+	}
+
+	client.MustPublish(ctx, message.MustNew(dropped.Topic, shared.TestData))
+
+	wg.Wait()
+
+	e, err := m.pull(ctx, m.consumers[0])
+	assert.NoError(t, err)
+	assert.Equal(t, malformed.Payload, e.Payload)
+	assert.Equal(t, shared.DocumentID, e.Headers["Correlation-Id"])
+	assert.Equal(t, poisoned.Topic, e.Headers[pubsub.HeaderTopic])
+	assert.NotEmpty(t, e.Headers[pubsub.HeaderError])
+
+	assert.NoError(t, client.Unsubscribe(ctx, hooked, poisoned, dropped))
+
+	// An outcome per policy, all counted as failures.
+	assert.Equal(t, int64(1), client.GetDecodeDroppedCounter().Value())
+	assert.Equal(t, int64(1), client.GetDecodeHookedCounter().Value())
+	assert.Equal(t, int64(1), client.GetDecodePoisonedCounter().Value())
+	assert.Equal(t, int64(3), client.GetSubscribedFailedCounter().Value())
+}
+
+func TestMemory_panic(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var (
+		wg          sync.WaitGroup
+		recovered   int64
+		redelivered int64
+	)
+
+	wg.Add(2 + 3)
+
+	// Recovered, the subscription keeps receiving messages.
+	recovering := subscription.MustNew("v1.meta.recovered", "v1.meta.recovered.queue", func(msg *message.Message) {
+		defer wg.Done()
+
+		if atomic.AddInt64(&recovered, 1) == 1 {
+			panic("boom")
+		}
+	})
+
+	assert.Equal(t, subscription.PanicRecover, recovering.PanicPolicy)
+
+	// Redelivered, then succeeds.
+	redeliver := subscription.MustNew("v1.meta.redelivered", "v1.meta.redelivered.queue", func(msg *message.Message) {
+		defer wg.Done()
+
+		if atomic.AddInt64(&redelivered, 1) < 3 {
+			panic(errors.New("boom"))
+		}
+	}, subscription.WithPanicRedelivery(5))
+
+	// Dead-lettered.
+	deadLetter := subscription.MustNew("v1.meta.deadlettered", "v1.meta.deadlettered.queue", func(msg *message.Message) {
+		panic("boom")
+	}, subscription.WithPanicDeadLetter(""))
+
+	assert.Equal(t, "v1.meta.deadlettered.dlq", deadLetter.DeadLetterTopic)
+
+	dlq := subscription.MustNew(deadLetter.DeadLetterTopic, "v1.meta.dlq.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{dlq}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustSubscribe(ctx, recovering, redeliver, deadLetter)
+
+	client.MustPublish(
+		ctx,
+		message.MustNew(recovering.Topic, shared.TestData),
+		message.MustNew(recovering.Topic, shared.TestData),
+		message.MustNew(redeliver.Topic, shared.TestData),
+		message.MustNew(deadLetter.Topic, shared.TestData),
+	)
+
+	msg, err := dlq.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, deadLetter.Topic, msg.GetHeader(pubsub.HeaderTopic))
+	assert.NotEmpty(t, msg.GetHeader(pubsub.HeaderError))
+
+	wg.Wait()
+
+	assert.NoError(t, client.Unsubscribe(ctx, recovering, redeliver, deadLetter))
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&recovered))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&redelivered))
+
+	// Every panic is counted, failures once per message.
+	assert.Equal(t, int64(4), client.GetHandlerPanickedCounter().Value())
+	assert.Equal(t, int64(2), client.GetSubscribedFailedCounter().Value())
+}
+
+func TestMemory_channel(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	const total = 4
+
+	var wg sync.WaitGroup
+
+	newSub := func(topic string, overflow subscription.OverflowPolicy) *subscription.Subscription {
+		wg.Add(total)
+
+		return subscription.MustNew(topic, topic+".queue", func(msg *message.Message) {
+			wg.Done()
+		}, subscription.WithChannel(2, overflow))
+	}
+
+	dropNewest := newSub("v1.meta.newest", subscription.OverflowDropNewest)
+	dropOldest := newSub("v1.meta.oldest", subscription.OverflowDropOldest)
+	failing := newSub("v1.meta.failing", subscription.OverflowError)
+
+	// Without a channel, nobody needs to read it.
+	noChannel := subscription.MustNew("v1.meta.nochannel", "v1.meta.nochannel.queue", func(msg *message.Message) {
+		wg.Done()
+	})
+
+	wg.Add(total)
+
+	subs := []*subscription.Subscription{dropNewest, dropOldest, failing, noChannel}
+
+	client.MustSubscribe(ctx, subs...)
+
+	// Nobody reads the channels.
+	for i := 0; i < total; i++ {
+		for _, s := range subs {
+			client.MustPublish(ctx, message.MustNew(s.Topic, i))
+		}
+	}
+
+	wg.Wait()
+
+	assert.NoError(t, client.Unsubscribe(ctx, subs...))
+
+	received := func(s *subscription.Subscription) []any {
+		data := []any{}
+
+		for msg := range s.Channel {
+			data = append(data, msg.Data)
+		}
+
+		return data
+	}
+
+	assert.Equal(t, []any{float64(0), float64(1)}, received(dropNewest))
+	assert.Equal(t, []any{float64(2), float64(3)}, received(dropOldest))
+	assert.Equal(t, []any{float64(0), float64(1)}, received(failing))
+	assert.Nil(t, noChannel.Channel)
+
+	assert.Equal(t, int64(6), client.GetChannelDroppedCounter().Value())
+
+	// Unbuffered channels hold nothing to drop, so drop the newest.
+	unbuffered := subscription.MustNew("v1.meta.unbuffered", "v1.meta.unbuffered.queue", nil, subscription.WithChannel(0, subscription.OverflowDropOldest))
+
+	client.MustSubscribe(ctx, unbuffered)
+	client.MustPublish(ctx, message.MustNew(unbuffered.Topic, shared.TestData))
+
+	assert.Eventually(t, func() bool {
+		return client.GetChannelDroppedCounter().Value() == 7
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	// Messages which handling failed aren't sent.
+	failed := subscription.MustNewWithHandler("v1.meta.failed", "v1.meta.failed.queue", func(ctx context.Context, msg *message.Message) error {
+		return errors.New("failed")
+	}, subscription.WithChannel(1, subscription.OverflowBlock))
+
+	client.MustSubscribe(ctx, failed)
+	client.MustPublish(ctx, message.MustNew(failed.Topic, shared.TestData))
+
+	assert.Eventually(t, func() bool {
+		return client.GetSubscribedFailedCounter().Value() == 1
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	assert.NoError(t, client.Unsubscribe(ctx, failed))
+
+	_, ok := <-failed.Channel
+	assert.False(t, ok)
+}
+
+func TestMemory_typed(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	sub := subscription.MustNewTyped(
+		"v1.meta.created",
+		"v1.meta.created.queue",
+		func(ctx context.Context, msg *message.Message, data shared.TestDataS) error {
+			defer wg.Done()
+
+			assert.Equal(t, *shared.TestData, data)
+
+			return nil
+		},
+		// Undecodable data doesn't reach the handler.
+		subscription.WithDecodeErrorHook(func(ctx context.Context, payload []byte, headers map[string]string, err error) {
+			defer wg.Done()
+
+			assert.Error(t, err)
+		}),
+	)
+
+	client.MustSubscribe(ctx, sub)
+
+	_, err = pubsub.PublishTyped(ctx, client, sub.Topic, *shared.TestData)
+	assert.NoError(t, err)
+
+	_, err = pubsub.PublishTyped(ctx, client, sub.Topic, "invalid")
+	assert.NoError(t, err)
+
+	wg.Wait()
+
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+	assert.Equal(t, int64(1), client.GetDecodeHookedCounter().Value())
+}
+
+func TestMemory_codec(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	for _, c := range []codec.Codec{codec.JSON, codec.MessagePack, codec.CBOR} {
+		e, err := client.(*Memory).Encode(ctx, message.MustNew(sub.Topic, shared.TestData), &pubsub.Options{Codec: c})
+		assert.NoError(t, err)
+		assert.Equal(t, c.ContentType(), e.Headers[codec.ContentTypeHeader])
+
+		// The message one is never overwritten.
+		published := message.MustNew(sub.Topic, shared.TestData)
+		published.SetHeader("Content-Type", "text/plain")
+
+		_, errs := client.Publish(ctx, []*message.Message{published}, pubsub.WithCodec(c))
+		assert.Empty(t, errs)
+
+		// Decoded automatically.
+		msg, err := sub.Next(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "text/plain", msg.GetHeader("Content-Type"))
+		assert.Empty(t, msg.GetHeader(codec.ContentTypeHeader))
+
+		var v shared.TestDataS
+
+		assert.NoError(t, msg.Process(msg.Data, &v))
+		assert.Equal(t, shared.TestData, &v)
+	}
+
+	_, errs = client.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, wrapperspb.String("test"))}, pubsub.WithCodec(codec.Protobuf))
+	assert.Empty(t, errs)
+
+	msg, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", msg.Data.(*wrapperspb.StringValue).GetValue())
+}
+
+func TestMemory_compression(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	large := strings.Repeat("pubsub", 1024)
+
+	tests := []struct {
+		data     string
+		encoding string
+	}{
+		// Below the threshold, not compressed.
+		{data: "small"},
+		{data: large, encoding: compression.Zstd.Encoding()},
+	}
+
+	for _, tt := range tests {
+		_, errs := client.Publish(
+			ctx,
+			[]*message.Message{message.MustNew(sub.Topic, tt.data)},
+			pubsub.WithCompression(compression.Zstd, compression.DefaultThreshold),
+		)
+		assert.Empty(t, errs)
+
+		// Decompressed automatically, the encoding isn't part of the message.
+		msg, err := sub.Next(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, msg.GetHeader(compression.ContentEncodingHeader))
+		assert.Equal(t, tt.data, msg.Data)
+
+		// Republished, uncompressed, it's still readable.
+		client.MustPublish(ctx, msg)
+
+		msg, err = sub.Next(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.data, msg.Data)
+	}
+
+	// Decompressing beyond the maximum size fails.
+	client.(*Memory).MaxDecompressedSize = len(large) - 1
+
+	_, errs = client.Publish(
+		ctx,
+		[]*message.Message{message.MustNew(sub.Topic, large)},
+		pubsub.WithCompression(compression.Zstd, compression.DefaultThreshold),
+	)
+	assert.Empty(t, errs)
+
+	// Dropped, nothing else to pull.
+	nextCtx, nextCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer nextCancel()
+
+	_, err = sub.Next(nextCtx)
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), client.GetDecodeDroppedCounter().Value())
+}
+
+func TestMemory_encryption(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	ring, err := encryption.NewKeyRing("k1", []byte("0123456789abcdef"))
+	assert.NoError(t, err)
+
+	m := client.(*Memory)
+
+	m.Encryptor = encryption.New().Add("v1.billing.>", ring)
+
+	sub := subscription.MustNew("v1.billing.charged", "v1.billing.charged.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// Decrypted automatically.
+	msg, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, msg.GetHeader(encryption.KeyIDHeader))
+
+	var v shared.TestDataS
+
+	assert.NoError(t, msg.Process(msg.Data, &v))
+	assert.Equal(t, shared.TestData, &v)
+
+	// Plaintext, e.g.: published by a client without the encryptor, so it's
+	// rejected.
+	encryptor := m.Encryptor
+
+	m.Encryptor = nil
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	m.Encryptor = encryptor
+
+	nextCtx, nextCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer nextCancel()
+
+	_, err = sub.Next(nextCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(1), client.GetPlaintextRejectedCounter().Value())
+	assert.Equal(t, int64(1), client.GetDecodeDroppedCounter().Value())
+
+	// Without the key, it's undecodable.
+	m.Encryptor = encryption.New().Add("v1.billing.>", writeOnly{ring})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	hooked := subscription.MustNew("v1.billing.refunded", "v1.billing.refunded.queue", nil, subscription.WithDecodeErrorHook(
+		func(ctx context.Context, payload []byte, headers map[string]string, err error) {
+			defer wg.Done()
+
+			assert.NotContains(t, string(payload), shared.DocumentName)
+			assert.Equal(t, "k1", headers[encryption.KeyIDHeader])
+			assert.Error(t, err)
+		},
+	))
+
+	client.MustSubscribe(ctx, hooked)
+
+	client.MustPublish(ctx, message.MustNew(hooked.Topic, shared.TestData))
+
+	wg.Wait()
+
+	assert.Equal(t, int64(1), client.GetDecodeHookedCounter().Value())
+}
+
+// writeOnly is a key provider which can encrypt, but not decrypt.
+type writeOnly struct {
+	*encryption.KeyRing
+}
+
+func (writeOnly) Get(ctx context.Context, id string) ([]byte, error) {
+	return nil, errors.New("not found")
+}
+
+func TestMemory_signing(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	key, err := signing.NewHMAC("billing", []byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+
+	m := client.(*Memory)
+
+	m.Signer = signing.New(signing.PolicyReject).
+		SignWith("v1.billing.>", key).
+		Trust("v1.billing.*", key)
+
+	sub := subscription.MustNew("v1.billing.charged", "v1.billing.charged.queue", nil)
+	quarantine := subscription.MustNew(sub.Topic+signing.DefaultQuarantineTopicSuffix, "v1.billing.quarantine.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub, quarantine}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	signed, err := m.Encode(ctx, message.MustNew(sub.Topic, shared.TestData), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", signed.Headers[signing.KeyIDHeader])
+	assert.NotEmpty(t, signed.Headers[signing.SignatureHeader])
+
+	// Forged, claiming to be signed by the billing service.
+	forged := &pubsub.Envelope{
+		Headers: copyHeaders(signed.Headers),
+		Payload: signed.Payload,
+	}
+
+	forged.Payload = []byte(strings.Replace(string(forged.Payload), shared.DocumentName, "forged", 1))
+
+	// Rejected, only the signed message is delivered.
+	for _, e := range []*pubsub.Envelope{forged, signed} {
+		_, err := m.send(ctx, sub.Topic, e)
+		assert.NoError(t, err)
+	}
+
+	msg, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, msg.GetHeader(signing.KeyIDHeader))
+	assert.Empty(t, msg.GetHeader(signing.SignatureHeader))
+	assert.Equal(t, int64(1), client.GetSignatureUnverifiedCounter().Value())
+
+	// Quarantined, routed as is.
+	m.Signer = signing.New(signing.PolicyQuarantine).Trust("v1.billing.*", key)
+
+	for _, e := range []*pubsub.Envelope{forged, signed} {
+		_, err := m.send(ctx, sub.Topic, e)
+		assert.NoError(t, err)
+	}
+
+	_, err = sub.Next(ctx)
+	assert.NoError(t, err)
+
+	msg, err = quarantine.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, sub.Topic, msg.GetHeader(pubsub.HeaderTopic))
+	assert.NotEmpty(t, msg.GetHeader(pubsub.HeaderError))
+	assert.Equal(t, int64(2), client.GetSignatureUnverifiedCounter().Value())
+
+	// Counted, and delivered.
+	m.Signer = signing.New(signing.PolicyCount).Trust("v1.billing.*", key)
+
+	_, err = m.send(ctx, sub.Topic, forged)
+	assert.NoError(t, err)
+
+	_, err = sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), client.GetSignatureUnverifiedCounter().Value())
+
+	// Headers, and the ID are signed too.
+	m.Signer = signing.New(signing.PolicyReject).Trust("v1.billing.*", key)
+
+	tenant := &pubsub.Envelope{Headers: copyHeaders(signed.Headers), Payload: signed.Payload}
+	tenant.Headers["tenant"] = "forged"
+
+	id := &pubsub.Envelope{Headers: copyHeaders(signed.Headers), Payload: signed.Payload}
+	id.Headers[pubsub.HeaderID] = "forged"
+
+	for _, e := range []*pubsub.Envelope{tenant, id, signed} {
+		_, err := m.send(ctx, sub.Topic, e)
+		assert.NoError(t, err)
+	}
+
+	msg, err = sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, msg.GetHeader("tenant"))
+	assert.Equal(t, signed.Message.ID, msg.ID)
+	assert.Equal(t, int64(5), client.GetSignatureUnverifiedCounter().Value())
+}
+
+// copyHeaders copies `headers`.
+func copyHeaders(headers map[string]string) map[string]string {
+	c := make(map[string]string, len(headers))
+
+	for k, v := range headers {
+		c[k] = v
+	}
+
+	return c
+}
+
+func TestMemory_deadLetter(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var attempts atomic.Int32
+
+	// Always fails, retried in process, then dead-lettered.
+	sub := subscription.MustNewWithHandler("v1.meta.failed", "v1.meta.failed.queue", func(ctx context.Context, msg *message.Message) error {
+		attempts.Add(1)
+
+		return errors.New("failed")
+	}, subscription.WithDeadLetter(3, ""))
+
+	assert.Equal(t, "v1.meta.failed.dlq", sub.DeadLetterTopic)
+
+	dlq := subscription.MustNew(sub.DeadLetterTopic, "v1.meta.dlq.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{dlq}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustSubscribe(ctx, sub)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// The original message, plus the failure metadata.
+	msg, err := dlq.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, sub.Topic, msg.Topic)
+	assert.Equal(t, sub.Topic, msg.GetHeader(pubsub.HeaderTopic))
+	assert.Equal(t, "3", msg.GetHeader(pubsub.HeaderAttempts))
+	assert.Contains(t, msg.GetHeader(pubsub.HeaderError), "failed")
+
+	failedAt, err := time.Parse(time.RFC3339Nano, msg.GetHeader(pubsub.HeaderFailedAt))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), failedAt, shared.DefaultTimeout)
+
+	var v shared.TestDataS
+
+	assert.NoError(t, msg.Process(msg.Data, &v))
+	assert.Equal(t, shared.TestData, &v)
+
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Equal(t, int64(3), client.GetSubscribedFailedCounter().Value())
+	assert.Equal(t, int64(1), client.GetDeadLetteredCounter().Value())
+	assert.Equal(t, int64(2), client.GetRetriedCounter().Value())
+	assert.Equal(t, int64(1), client.GetRetryExhaustedCounter().Value())
+}
+
+func TestMemory_deadLetterPipeline(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	ring, err := encryption.NewKeyRing("k1", []byte("0123456789abcdef"))
+	assert.NoError(t, err)
+
+	key, err := signing.NewHMAC("billing", []byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+
+	m := client.(*Memory)
+
+	m.Encryptor = encryption.New().Add("v1.billing.>", ring)
+	m.Signer = signing.New(signing.PolicyReject).
+		SignWith("v1.billing.>", key).
+		Trust("v1.billing.>", key)
+
+	sub := subscription.MustNewWithHandler("v1.billing.charged", "v1.billing.charged.queue", func(ctx context.Context, msg *message.Message) error {
+		return errors.New("failed")
+	}, subscription.WithDeadLetter(1, ""))
+
+	dlq := subscription.MustNew(sub.DeadLetterTopic, "v1.billing.dlq.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{dlq}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	client.MustSubscribe(ctx, sub)
+
+	// Compressed, encrypted, signed, and encoded with another codec than the
+	// pubsub one.
+	published, errs := client.Publish(
+		ctx,
+		[]*message.Message{message.MustNew(sub.Topic, shared.TestData)},
+		pubsub.WithCodec(codec.MessagePack),
+		pubsub.WithCompression(compression.Gzip, 1),
+	)
+	assert.Empty(t, errs)
+
+	// Forwarded as is, so it's still readable, and verified.
+	msg, err := dlq.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, published[0].ID, msg.ID)
+	assert.Equal(t, sub.Topic, msg.GetHeader(pubsub.HeaderTopic))
+	assert.Equal(t, "1", msg.GetHeader(pubsub.HeaderAttempts))
+
+	var v shared.TestDataS
+
+	assert.NoError(t, msg.Process(msg.Data, &v))
+	assert.Equal(t, shared.TestData, &v)
+
+	assert.Equal(t, int64(1), client.GetDeadLetteredCounter().Value())
+	assert.Equal(t, int64(0), client.GetDecodeDroppedCounter().Value())
+	assert.Equal(t, int64(0), client.GetSignatureUnverifiedCounter().Value())
+}
+
+func TestMemory_retry(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var attempts atomic.Int32
+
+	done := make(chan struct{})
+
+	// Fails twice, then succeeds.
+	sub := subscription.MustNewWithHandler("v1.meta.retried", "v1.meta.retried.queue", func(ctx context.Context, msg *message.Message) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("failed")
+		}
+
+		close(done)
+
+		return nil
+	}, subscription.WithRetry(backoff.Constant(3, 10*time.Millisecond)))
+
+	client.MustSubscribe(ctx, sub)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("not retried")
+	}
+
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Eventually(t, func() bool {
+		return client.GetRetrySucceededCounter().Value() == 1
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+	assert.Equal(t, int64(2), client.GetRetriedCounter().Value())
+	assert.Equal(t, int64(0), client.GetRetryExhaustedCounter().Value())
+}
+
+func TestMemory_middleware(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	errUnauthorized := errors.New("unauthorized")
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+
+	record := func(name string) subscription.HandlerMiddleware {
+		return func(next subscription.HandlerFunc) subscription.HandlerFunc {
+			return func(ctx context.Context, msg *message.Message) error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	m := client.(*Memory)
+
+	// Enriches, and authorizes publishes.
+	m.PublishMiddlewares = []pubsub.PublishMiddleware{
+		func(next pubsub.PublishHandler) pubsub.PublishHandler {
+			return func(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+				msg.SetHeader("Tenant", "acme")
+
+				return next(ctx, msg, o)
+			}
+		},
+		func(next pubsub.PublishHandler) pubsub.PublishHandler {
+			return func(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+				if msg.Topic == "v1.meta.forbidden" {
+					return msg, errUnauthorized
+				}
+
+				return next(ctx, msg, o)
+			}
+		},
+	}
+
+	m.HandlerMiddlewares = []subscription.HandlerMiddleware{record("pubsub")}
+
+	received := make(chan *message.Message, 1)
+
+	sub := subscription.MustNewWithHandler("v1.meta.wrapped", "v1.meta.wrapped.queue", func(ctx context.Context, msg *message.Message) error {
+		received <- msg
+
+		return nil
+	}, subscription.WithMiddleware(record("first"), record("second")))
+
+	client.MustSubscribe(ctx, sub)
+
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "acme", msg.GetHeader("Tenant"))
+	case <-ctx.Done():
+		t.Fatal("not received")
+	}
+
+	mu.Lock()
+	assert.Equal(t, []string{"pubsub", "first", "second"}, order)
+	mu.Unlock()
+
+	_, errs := client.Publish(ctx, []*message.Message{message.MustNew("v1.meta.forbidden", shared.TestData)})
+	assert.NotEmpty(t, errs)
+	assert.ErrorIs(t, errs[0], errUnauthorized)
+}
+
+func TestMemory_dedup(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	var handled atomic.Int32
+
+	store := dedup.NewMemory(100, time.Minute)
+
+	sub := subscription.MustNewWithHandler("v1.meta.deduped", "v1.meta.deduped.queue", func(ctx context.Context, msg *message.Message) error {
+		handled.Add(1)
+
+		return nil
+	}, subscription.WithDedup(store, nil))
+
+	client.MustSubscribe(ctx, sub)
+
+	// Same message, published twice, as if redelivered.
+	msg := message.MustNew(sub.Topic, shared.TestData)
+
+	client.MustPublish(ctx, msg)
+
+	// Recorded once handled.
+	assert.Eventually(t, func() bool {
+		return store.Len() == 1
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	client.MustPublish(ctx, msg)
+
+	assert.Eventually(t, func() bool {
+		return client.GetDeduplicatedCounter().Value() == 1
+	}, shared.DefaultTimeout, 10*time.Millisecond)
+
+	assert.Equal(t, int32(1), handled.Load())
+}
+
+func TestMemory_concurrentPublish(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	tx := apm.DefaultTracer.StartTransaction("publish", "test")
+	defer tx.End()
+
+	txCtx := apm.ContextWithTransaction(ctx, tx)
+
+	// Messages sharing their headers, published concurrently.
+	headers := map[string]string{"tenant": "acme"}
+
+	msgs := make([]*message.Message, 10)
+
+	for i := range msgs {
+		msgs[i] = message.MustNew("v1.meta.concurrent", shared.TestData)
+		msgs[i].Headers = headers
+	}
+
+	published, errs := client.Publish(txCtx, msgs, pubsub.WithContentID())
+	assert.Empty(t, errs)
+	assert.Len(t, published, len(msgs))
+
+	content, err := msgs[0].ContentID()
+	assert.NoError(t, err)
+
+	for i, msg := range published {
+		assert.Equal(t, content, msg.ID)
+		assert.Empty(t, msg.GetHeader(codec.ContentTypeHeader))
+
+		// Never modified.
+		assert.NotEqual(t, content, msgs[i].ID)
+	}
+
+	assert.Equal(t, map[string]string{"tenant": "acme"}, headers)
+}
+
+func TestMemory_selfUnsubscribe(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	unsubscribed := make(chan error, 1)
+
+	var sub *subscription.Subscription
+
+	sub = subscription.MustNew("v1.meta.deleted", "v1.meta.deleted.queue", func(msg *message.Message) {
+		unsubscribed <- client.Unsubscribe(ctx, sub)
+	}, subscription.WithChannel(1, subscription.OverflowDropNewest))
+
+	client.MustSubscribe(ctx, sub)
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// Handlers can unsubscribe their own subscription, without deadlocking.
+	select {
+	case err := <-unsubscribed:
+		assert.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("unsubscribing from the handler deadlocked")
+	}
+
+	// The channel is closed once the delivery is done.
+	for range sub.Channel {
+	}
+
+	assert.Equal(t, status.Stopped, sub.Status)
+}
+
+func TestGet(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	Set(nil)
+
+	assert.PanicsWithError(t, errorcatalog.Get().MustGet(errorcatalog.PubSubErrMemoryNilMessage).NewFailedToError().Error(), func() {
+		Get()
+	})
+
+	client, err := New(context.Background())
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	assert.Equal(t, client, Get())
+}
@@ -1,11 +1,15 @@
 package message
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/WreckingBallStudioLabs/pubsub/common"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
 	"github.com/WreckingBallStudioLabs/pubsub/name"
+	"github.com/thalesfsp/customerror"
 	"github.com/thalesfsp/status"
 )
 
@@ -13,12 +17,45 @@ import (
 // Const, vars, and types.
 //////
 
+// Responder sends `reply` back to whoever published the message.
+type Responder func(ctx context.Context, reply *Message) error
+
+// Acker acknowledges a delivered message to the pubsub. It's set by pubsubs
+// supporting acknowledgements, e.g.: JetStream.
+type Acker interface {
+	// Ack acknowledges the message was handled.
+	Ack(ctx context.Context) error
+
+	// Nack signals the message handling failed, so it's redelivered after
+	// `delay`.
+	Nack(ctx context.Context, delay time.Duration) error
+
+	// InProgress signals the message is still being handled, postponing its
+	// redelivery.
+	InProgress(ctx context.Context) error
+
+	// Term signals the message can't be handled, so it's never redelivered.
+	Term(ctx context.Context) error
+}
+
 // Message definition.
 type Message struct {
 	common.Common
 
 	// Data to be published.
 	Data any `json:"data"`
+
+	// Headers are the message metadata, e.g.: correlation ID, content type,
+	// tenant, or trace context. They are transported natively by the pubsub,
+	// apart from the data.
+	Headers map[string]string `json:"-"`
+
+	// acker acknowledges the message. Only set by pubsubs supporting
+	// acknowledgements.
+	acker Acker
+
+	// responder replies to the message. Only set for requests.
+	responder Responder
 }
 
 //////
@@ -39,6 +76,111 @@ func (m *Message) Process(b any, v any) error {
 	return nil
 }
 
+// ContentID returns an ID derived from the message topic, and canonical (JSON)
+// encoded data, see `shared.GenerateID`, so messages with the same content have
+// the same ID.
+func (m *Message) ContentID() (string, error) {
+	b, err := json.Marshal(m.Data)
+	if err != nil {
+		return "", err
+	}
+
+	return shared.GenerateID(m.Topic + "\x00" + string(b)), nil
+}
+
+// SetHeader sets the header `key` to `value`.
+func (m *Message) SetHeader(key, value string) {
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+
+	m.Headers[key] = value
+}
+
+// GetHeader returns the value of the header `key`, if any.
+func (m *Message) GetHeader(key string) string {
+	return m.Headers[key]
+}
+
+// SetAcker sets how to acknowledge the message. It's set by the pubsub when
+// delivering a message, if it supports acknowledgements.
+func (m *Message) SetAcker(acker Acker) {
+	m.acker = acker
+}
+
+// Ack acknowledges the message was handled. It's a no-op for pubsubs without
+// acknowledgements, e.g.: memory, and NATS.
+func (m *Message) Ack(ctx context.Context) error {
+	if m.acker == nil {
+		return nil
+	}
+
+	return m.acker.Ack(ctx)
+}
+
+// Nack signals the message handling failed, so it's redelivered after `delay`.
+// It's a no-op for pubsubs without acknowledgements.
+func (m *Message) Nack(ctx context.Context, delay time.Duration) error {
+	if m.acker == nil {
+		return nil
+	}
+
+	return m.acker.Nack(ctx, delay)
+}
+
+// InProgress signals the message is still being handled, postponing its
+// redelivery. Useful for long handlings. It's a no-op for pubsubs without
+// acknowledgements.
+func (m *Message) InProgress(ctx context.Context) error {
+	if m.acker == nil {
+		return nil
+	}
+
+	return m.acker.InProgress(ctx)
+}
+
+// Term signals the message can't be handled, so it's never redelivered. It's a
+// no-op for pubsubs without acknowledgements.
+func (m *Message) Term(ctx context.Context) error {
+	if m.acker == nil {
+		return nil
+	}
+
+	return m.acker.Term(ctx)
+}
+
+// SetResponder sets how to reply to the message. It's set by the pubsub when
+// delivering a message published synchronously (request).
+func (m *Message) SetResponder(responder Responder) {
+	m.responder = responder
+}
+
+// IsRequest returns true if the message expects a reply.
+func (m *Message) IsRequest() bool {
+	return m.responder != nil
+}
+
+// Respond replies to the message with `data`. It fails if the message isn't a
+// request, see `pubsub.WithSync`.
+func (m *Message) Respond(ctx context.Context, data any) error {
+	if m.responder == nil {
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrMessageNotRequest).
+			NewFailedToError(
+				customerror.WithField("topic", m.Topic),
+				customerror.WithField("id", m.ID),
+			)
+	}
+
+	reply, err := New(m.Topic, data)
+	if err != nil {
+		return err
+	}
+
+	return m.responder(ctx, reply)
+}
+
 //////
 // Factory.
 //////
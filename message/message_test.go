@@ -1,7 +1,9 @@
 package message
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thalesfsp/status"
@@ -42,3 +44,101 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestMessage_Respond(t *testing.T) {
+	msg := MustNew("v1.meta.created", "data")
+
+	// Not a request.
+	assert.False(t, msg.IsRequest())
+	assert.Error(t, msg.Respond(context.Background(), "reply"))
+
+	var got *Message
+
+	msg.SetResponder(func(ctx context.Context, reply *Message) error {
+		got = reply
+
+		return nil
+	})
+
+	assert.True(t, msg.IsRequest())
+	assert.NoError(t, msg.Respond(context.Background(), "reply"))
+	assert.Equal(t, msg.Topic, got.Topic)
+	assert.Equal(t, "reply", got.Data)
+}
+
+// acker records the acknowledgements.
+type acker struct {
+	calls []string
+}
+
+func (a *acker) Ack(ctx context.Context) error {
+	a.calls = append(a.calls, "ack")
+
+	return nil
+}
+
+func (a *acker) Nack(ctx context.Context, delay time.Duration) error {
+	a.calls = append(a.calls, "nack")
+
+	return nil
+}
+
+func (a *acker) InProgress(ctx context.Context) error {
+	a.calls = append(a.calls, "inprogress")
+
+	return nil
+}
+
+func (a *acker) Term(ctx context.Context) error {
+	a.calls = append(a.calls, "term")
+
+	return nil
+}
+
+func TestMessage_Ack(t *testing.T) {
+	ctx := context.Background()
+
+	msg := MustNew("v1.meta.created", "data")
+
+	// No-ops without acker.
+	assert.NoError(t, msg.Ack(ctx))
+	assert.NoError(t, msg.Nack(ctx, time.Second))
+	assert.NoError(t, msg.InProgress(ctx))
+	assert.NoError(t, msg.Term(ctx))
+
+	a := &acker{}
+
+	msg.SetAcker(a)
+
+	assert.NoError(t, msg.InProgress(ctx))
+	assert.NoError(t, msg.Nack(ctx, time.Second))
+	assert.NoError(t, msg.Ack(ctx))
+	assert.NoError(t, msg.Term(ctx))
+	assert.Equal(t, []string{"inprogress", "nack", "ack", "term"}, a.calls)
+}
+
+func TestMessage_SetHeader(t *testing.T) {
+	msg := MustNew("v1.meta.created", "data")
+
+	assert.Empty(t, msg.GetHeader("Correlation-Id"))
+
+	msg.SetHeader("Correlation-Id", "123")
+
+	assert.Equal(t, "123", msg.GetHeader("Correlation-Id"))
+}
+
+func TestMessage_ContentID(t *testing.T) {
+	id, err := MustNew("v1.meta.created", "data").ContentID()
+	assert.NoError(t, err)
+
+	same, err := MustNew("v1.meta.created", "data").ContentID()
+	assert.NoError(t, err)
+	assert.Equal(t, id, same)
+
+	other, err := MustNew("v1.meta.updated", "data").ContentID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, other)
+
+	_, err = MustNew("v1.meta.created", make(chan int)).ContentID()
+	assert.Error(t, err)
+}
@@ -50,6 +50,26 @@ func (n Name) Parts() []string {
 	return nameRegex.FindStringSubmatch(n.String())
 }
 
+// Match returns true if the name matches `pattern`. Patterns are names where
+// "*" matches exactly one part, and a trailing ">" matches one or more parts,
+// e.g.: "v1.billing.*", or "v1.>".
+func (n Name) Match(pattern string) bool {
+	parts := strings.Split(n.String(), ".")
+	tokens := strings.Split(pattern, ".")
+
+	for i, token := range tokens {
+		if token == ">" && i == len(tokens)-1 {
+			return len(parts) > i
+		}
+
+		if i >= len(parts) || (token != "*" && token != parts[i]) {
+			return false
+		}
+	}
+
+	return len(parts) == len(tokens)
+}
+
 // ToQueue converts a Name to a Queue, adding the .queue suffix only if it's not
 // already there.
 func (n Name) ToQueue() Queue {
@@ -129,3 +129,25 @@ func TestName_ToTopic(t *testing.T) {
 		})
 	}
 }
+
+func TestName_Match(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected bool
+	}{
+		{"v1.billing.charged", true},
+		{"v1.billing.*", true},
+		{"v1.*.charged", true},
+		{"v1.>", true},
+		{"v1.billing.charged.>", false},
+		{"v1.billing", false},
+		{"v1.users.*", false},
+		{"v2.>", false},
+	}
+
+	for _, tc := range testCases {
+		if result := Name("v1.billing.charged").Match(tc.pattern); result != tc.expected {
+			t.Errorf("Expected Match(%q) to be %v, got %v", tc.pattern, tc.expected, result)
+		}
+	}
+}
@@ -2,12 +2,13 @@ package nats
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
-	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/natsutil"
 	"github.com/WreckingBallStudioLabs/pubsub/message"
 	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
 	"github.com/WreckingBallStudioLabs/pubsub/subscription"
@@ -47,6 +48,108 @@ type NATS struct {
 
 	// URL is the NATS URL.
 	URL string `json:"url" validate:"required"`
+
+	// mu guards handles.
+	mu sync.Mutex
+
+	// handles are the underlying NATS subscriptions, keyed by subscription.
+	handles map[*subscription.Subscription]*natsutil.Handle
+}
+
+//////
+// Helpers.
+//////
+
+// toEnvelope converts a NATS message to an envelope. Requests can be replied.
+func toEnvelope(m *natsgo.Msg) *pubsub.Envelope {
+	e := &pubsub.Envelope{
+		Topic:   m.Subject,
+		Headers: natsutil.FromHeader(m.Header),
+		Payload: m.Data,
+	}
+
+	if m.Reply != "" {
+		e.Respond = func(ctx context.Context, reply *pubsub.Envelope) error {
+			return m.RespondMsg(&natsgo.Msg{
+				Data:   reply.Payload,
+				Header: natsutil.ToHeader(reply.Headers),
+			})
+		}
+	}
+
+	return e
+}
+
+// send publishes `e`, as is, to `topic`.
+func (n *NATS) send(topic string, e *pubsub.Envelope) error {
+	return n.Client.PublishMsg(&natsgo.Msg{
+		Subject: topic,
+		Data:    e.Payload,
+		Header:  natsutil.ToHeader(e.Headers),
+	})
+}
+
+// publish encodes, and publishes `msg`, or requests, if synchronous.
+func (n *NATS) publish(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+	e, err := n.Encode(ctx, msg, o)
+	if err != nil {
+		return msg, err
+	}
+
+	msg = e.Message
+
+	if o.Sync {
+		return n.request(ctx, msg, e)
+	}
+
+	if err := n.Protect(ctx, func(context.Context) error {
+		return n.send(msg.Topic, e)
+	}); err != nil {
+		return msg, errorcatalog.
+			Get().
+			MustGet(
+				errorcatalog.PubSubErrNATSPublish,
+				customerror.WithError(err),
+				customerror.WithField("topic", msg.Topic),
+				customerror.WithField("id", msg.ID),
+			).NewFailedToError()
+	}
+
+	return msg, nil
+}
+
+// request publishes `e`, and waits for the reply, through the resilience
+// layer, if set, see `pubsub.PubSub.Protect`.
+func (n *NATS) request(ctx context.Context, msg *message.Message, e *pubsub.Envelope) (*message.Message, error) {
+	var r *natsgo.Msg
+
+	if err := n.Protect(ctx, func(ctx context.Context) error {
+		var err error
+
+		r, err = n.Client.RequestMsgWithContext(ctx, &natsgo.Msg{
+			Subject: msg.Topic,
+			Data:    e.Payload,
+			Header:  natsutil.ToHeader(e.Headers),
+		})
+
+		return err
+	}); err != nil {
+		return msg, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrNATSRequest).
+			NewFailedToError(
+				customerror.WithError(err),
+				customerror.WithField("topic", msg.Topic),
+				customerror.WithField("id", msg.ID),
+			)
+	}
+
+	reply, err := n.DecodeReply(ctx, msg.Topic, toEnvelope(r))
+	if err != nil {
+		return msg, err
+	}
+
+	return reply, nil
 }
 
 //////
@@ -97,38 +200,7 @@ func (n *NATS) Publish(
 				}
 			}
 
-			if o.Sync {
-				return message, customapm.TraceError(
-					ctx,
-					errorcatalog.
-						Get().
-						MustGet(errorcatalog.PubSubErrPubSubNotImpl).
-						NewFailedToError(
-							customerror.WithField("topic", message.Topic),
-							customerror.WithField("id", message.ID),
-						),
-					n.GetLogger(),
-					n.GetPublishedFailedCounter(),
-				)
-			}
-
-			payload, err := shared.MarshalIndent(message, "", "  ")
-			if err != nil {
-				return message, err
-			}
-
-			if err := n.Client.Publish(message.Topic, payload); err != nil {
-				return message, errorcatalog.
-					Get().
-					MustGet(
-						errorcatalog.PubSubErrNATSPublish,
-						customerror.WithError(err),
-						customerror.WithField("topic", message.Topic),
-						customerror.WithField("id", message.ID),
-					).NewFailedToError()
-			}
-
-			return message, nil
+			return n.Publishing(n.publish)(ctx, message, o)
 		})
 	if err != nil {
 		_ = customapm.TraceError(ctx, err, n.GetLogger(), n.GetPublishedFailedCounter())
@@ -202,6 +274,10 @@ func (n *NATS) Subscribe(
 				return subscription, err
 			}
 
+			if err := subscription.CanSubscribe(); err != nil {
+				return subscription, err
+			}
+
 			//////
 			// Process options.
 			//////
@@ -217,33 +293,39 @@ func (n *NATS) Subscribe(
 				}
 			}
 
-			if o.Sync {
-				return subscription, errorcatalog.
-					Get().
-					MustGet(errorcatalog.PubSubErrPubSubNotImpl).
-					NewFailedToError(
-						customerror.WithField("topic", subscription.Topic),
-						customerror.WithField("id", subscription.ID),
-					)
-			}
+			// Subscribing twice is a no-op.
+			n.mu.Lock()
+			_, subscribed := n.handles[subscription]
+			n.mu.Unlock()
 
-			_, err = n.Client.QueueSubscribe(subscription.Topic, subscription.Queue, func(m *natsgo.Msg) {
-				var msg message.Message
+			if subscribed {
+				return subscription, nil
+			}
 
-				if err := shared.Unmarshal(m.Data, &msg); err != nil {
-					panic(customapm.TraceError(ctx, err, n.GetLogger(), n.GetSubscribedFailedCounter()))
-				}
+			// Deliveries outlive the subscribe operation, hence their own
+			// context, cancelled once unsubscribed.
+			deliveriesCtx, cancel := context.WithCancel(context.Background())
 
-				// Runs the subscription handler function.
-				subscription.Func(&msg)
+			h := natsutil.NewHandle(cancel)
 
-				// Also sends the data to the channel.
-				subscription.Channel <- &msg
-			})
+			if o.Sync {
+				h.Subscription, err = n.Client.QueueSubscribeSync(subscription.Topic, subscription.Queue)
+			} else {
+				h.Subscription, err = n.Client.QueueSubscribe(subscription.Topic, subscription.Queue, func(m *natsgo.Msg) {
+					h.Deliver(func() {
+						// Core NATS doesn't redeliver, failures are only reported.
+						_ = n.Receive(deliveriesCtx, subscription, toEnvelope(m))
+					})
+				})
+			}
 			if err != nil {
-				close(subscription.Channel)
+				cancel()
 
-				subscription.Channel = nil
+				if subscription.Channel != nil {
+					close(subscription.Channel)
+
+					subscription.Channel = nil
+				}
 
 				return subscription, errorcatalog.
 					Get().
@@ -255,6 +337,33 @@ func (n *NATS) Subscribe(
 					).NewFailedToError()
 			}
 
+			n.mu.Lock()
+			_, subscribed = n.handles[subscription]
+
+			if !subscribed {
+				n.handles[subscription] = h
+			}
+			n.mu.Unlock()
+
+			// Subscribed concurrently, meanwhile.
+			if subscribed {
+				cancel()
+
+				_ = h.Unsubscribe()
+
+				return subscription, nil
+			}
+
+			if o.Sync {
+				subscription.SetNext(func(ctx context.Context) (*message.Message, error) {
+					return n.Pull(ctx, subscription, func(ctx context.Context) (*pubsub.Envelope, error) {
+						return h.Pull(ctx, subscription, errorcatalog.PubSubErrNATSNext, toEnvelope)
+					})
+				})
+			}
+
+			subscription.Status = status.Subscribed
+
 			return subscription, nil
 		})
 	if err != nil {
@@ -298,17 +407,60 @@ func (n *NATS) MustSubscribeAsync(ctx context.Context, subscriptions ...*subscri
 	go n.MustSubscribe(ctx, subscriptions...)
 }
 
-// Unsubscribe from a topic.
+// Unsubscribe from a topic. It stops the delivery, and closes the subscription
+// channel, once the in-flight delivery is done, so handlers can unsubscribe
+// their own subscription. Unsubscribed subscriptions can't be subscribed again.
 func (n *NATS) Unsubscribe(ctx context.Context, subscriptions ...*subscription.Subscription) error {
-	n.GetLogger().Warnln(
-		errorcatalog.Get().MustGet(errorcatalog.PubSubErrPubSubNotImpl).NewFailedToError(),
-	)
+	var errs concurrentloop.Errors
+
+	for _, s := range subscriptions {
+		n.mu.Lock()
+		h, ok := n.handles[s]
+		delete(n.handles, s)
+		n.mu.Unlock()
+
+		if !ok {
+			errs = append(errs, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrSubscriptionNotFound).
+				NewFailedToError(
+					customerror.WithField("topic", s.Topic),
+					customerror.WithField("id", s.ID),
+				))
+
+			continue
+		}
+
+		if err := h.Stop(s); err != nil {
+			errs = append(errs, errorcatalog.
+				Get().
+				MustGet(
+					errorcatalog.PubSubErrNATSUnsubscribe,
+					customerror.WithError(err),
+					customerror.WithField("topic", s.Topic),
+					customerror.WithField("id", s.ID),
+				).NewFailedToError())
+		}
+	}
+
+	if errs != nil {
+		return customapm.TraceError(ctx, errs, n.GetLogger(), nil)
+	}
 
 	return nil
 }
 
-// Close the connection to the Pub Sub broker.
+// Close the connection to the Pub Sub broker, unsubscribing all subscriptions.
 func (n *NATS) Close() error {
+	n.mu.Lock()
+	handles := n.handles
+	n.handles = map[*subscription.Subscription]*natsutil.Handle{}
+	n.mu.Unlock()
+
+	for s, h := range handles {
+		_ = h.Stop(s)
+	}
+
 	n.Client.Close()
 
 	return nil
@@ -356,6 +508,23 @@ func New(ctx context.Context, url string, options ...Option) (pubsub.IPubSub, er
 		Client:  natsConn,
 		Options: options,
 		URL:     url,
+
+		handles: map[*subscription.Subscription]*natsutil.Handle{},
+	}
+
+	// Routes messages, e.g.: to poison topics.
+	p.Sender = func(ctx context.Context, topic string, e *pubsub.Envelope) error {
+		if err := client.send(topic, e); err != nil {
+			return errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrNATSPublish).
+				NewFailedToError(
+					customerror.WithError(err),
+					customerror.WithField("topic", topic),
+				)
+		}
+
+		return nil
 	}
 
 	singleton = client
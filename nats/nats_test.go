@@ -6,10 +6,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
 	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/signing"
 	"github.com/WreckingBallStudioLabs/pubsub/subscription"
 	"github.com/stretchr/testify/assert"
+	"github.com/thalesfsp/status"
 )
 
 func TestNew(t *testing.T) {
@@ -82,11 +86,15 @@ func TestNew(t *testing.T) {
 				}
 
 				assert.Equal(t, shared.TestData, &v)
-			})
+				assert.Equal(t, shared.DocumentID, msg.GetHeader("Correlation-Id"))
+
+				// Trace is propagated.
+				assert.NotEmpty(t, msg.GetHeader("traceparent"))
+			}, subscription.WithChannel(1, subscription.OverflowBlock))
 
-			// And here is the channel way.
+			// And here is the channel way, opted-in with `WithChannel`.
 			//
-			// NOTE: The channel is buffered, so it's important to read from it
+			// NOTE: The channel is bounded, so it's important to read from it
 			// in a goroutine.
 			// NOTE: Optionally, listen to the `ctx.Done` channel to stop the
 			// goroutine.
@@ -95,7 +103,12 @@ func TestNew(t *testing.T) {
 					select {
 					case <-ctx.Done():
 						return
-					case msg := <-sub.Channel:
+					case msg, ok := <-sub.Channel:
+						// Channel is closed on `Unsubscribe`.
+						if !ok {
+							return
+						}
+
 						var v shared.TestDataS
 
 						if err := msg.Process(msg.Data, &v); err != nil {
@@ -123,7 +136,12 @@ func TestNew(t *testing.T) {
 					// 4. Publish to the channel.
 					//
 					// Smartly reuse `subs` topic, less typing, less error prone.
-					client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+					msg := message.MustNew(sub.Topic, shared.TestData)
+
+					// Headers are transported apart from the data.
+					msg.SetHeader("Correlation-Id", shared.DocumentID)
+
+					client.MustPublish(ctx, msg)
 				})
 			}
 
@@ -135,6 +153,235 @@ func TestNew(t *testing.T) {
 			assert.Equal(t, int64(0), client.GetPublishedFailedCounter().Value())
 			assert.Equal(t, int64(1), client.GetSubscribedCounter().Value())
 			assert.Equal(t, int64(0), client.GetSubscribedFailedCounter().Value())
+
+			//////
+			// Should be able to unsubscribe.
+			//////
+
+			assert.NoError(t, client.Unsubscribe(ctx, sub))
+
+			_, ok := <-sub.Channel
+			assert.False(t, ok)
+
+			// Unsubscribing twice should fail.
+			assert.Error(t, client.Unsubscribe(ctx, sub))
+
+			// Subscribing again fails, its channel is closed.
+			_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub})
+			assert.NotEmpty(t, errs)
+
+			assert.NotPanics(t, func() {
+				client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+			})
 		})
 	}
 }
+
+func TestNATS_request(t *testing.T) {
+	if !shared.IsEnvironment(shared.Integration) {
+		t.Skip("Skipping test. Not in e2e " + shared.Integration + "environment.")
+	}
+
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	host := os.Getenv("NATS_HOST")
+
+	if host == "" {
+		t.Fatal("NATS_HOST is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, host)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.requested", "v1.meta.requested.queue", func(msg *message.Message) {
+		assert.True(t, msg.IsRequest())
+		assert.NoError(t, msg.Respond(ctx, shared.UpdatedTestData))
+	})
+
+	client.MustSubscribe(ctx, sub)
+
+	replies, errs := client.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+	assert.Len(t, replies, 1)
+
+	var v shared.TestDataS
+
+	assert.NoError(t, replies[0].Process(replies[0].Data, &v))
+	assert.Equal(t, shared.UpdatedTestData, &v)
+
+	// Requests are protected too: without responders, they're retried.
+	client.(*NATS).Resilience = pubsub.NewResilience().WithRetry(backoff.Constant(2, time.Millisecond))
+
+	_, errs = client.Publish(ctx, []*message.Message{message.MustNew("v1.meta.unanswered", shared.TestData)}, pubsub.WithSync(true))
+	assert.NotEmpty(t, errs)
+	assert.Equal(t, int64(2), client.GetPublishRetriedCounter().Value())
+}
+
+func TestNATS_signedRequest(t *testing.T) {
+	if !shared.IsEnvironment(shared.Integration) {
+		t.Skip("Skipping test. Not in e2e " + shared.Integration + "environment.")
+	}
+
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	host := os.Getenv("NATS_HOST")
+
+	if host == "" {
+		t.Fatal("NATS_HOST is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	requester, err := New(ctx, host)
+	assert.NoError(t, err)
+
+	defer requester.Close()
+
+	// Replies without signing.
+	replier, err := New(ctx, host)
+	assert.NoError(t, err)
+
+	defer replier.Close()
+
+	key, err := signing.NewHMAC("billing", []byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+
+	requester.(*NATS).Signer = signing.New(signing.PolicyReject).
+		SignWith("v1.billing.>", key).
+		Trust("v1.billing.*", key)
+
+	sub := subscription.MustNew("v1.billing.requested", "v1.billing.requested.queue", func(msg *message.Message) {
+		assert.NoError(t, msg.Respond(ctx, shared.UpdatedTestData))
+	})
+
+	replier.MustSubscribe(ctx, sub)
+
+	// Unsigned, so rejected.
+	_, errs := requester.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithSync(true))
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "verify reply")
+	assert.Equal(t, int64(1), requester.GetSignatureUnverifiedCounter().Value())
+
+	// Counted, but accepted.
+	requester.(*NATS).Signer = signing.New(signing.PolicyCount).Trust("v1.billing.*", key)
+
+	replies, errs := requester.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+	assert.Len(t, replies, 1)
+	assert.Equal(t, int64(2), requester.GetSignatureUnverifiedCounter().Value())
+
+	// Signed for the request topic, so verified.
+	replier.(*NATS).Signer = signing.New(signing.PolicyReject).SignWith("v1.billing.>", key)
+	requester.(*NATS).Signer = signing.New(signing.PolicyReject).Trust("v1.billing.*", key)
+
+	replies, errs = requester.Publish(ctx, []*message.Message{message.MustNew(sub.Topic, shared.TestData)}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+	assert.Len(t, replies, 1)
+	assert.Equal(t, int64(2), requester.GetSignatureUnverifiedCounter().Value())
+
+	var v shared.TestDataS
+
+	assert.NoError(t, replies[0].Process(replies[0].Data, &v))
+	assert.Equal(t, shared.UpdatedTestData, &v)
+}
+
+func TestNATS_sync(t *testing.T) {
+	if !shared.IsEnvironment(shared.Integration) {
+		t.Skip("Skipping test. Not in e2e " + shared.Integration + "environment.")
+	}
+
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	host := os.Getenv("NATS_HOST")
+
+	if host == "" {
+		t.Fatal("NATS_HOST is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, host)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.pulled", "v1.meta.pulled.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+
+	// Subscribing twice is a no-op.
+	_, errs = client.Subscribe(ctx, []*subscription.Subscription{sub, sub}, pubsub.WithSync(true))
+	assert.Empty(t, errs)
+	assert.Equal(t, 1, client.(*NATS).Client.NumSubscriptions())
+
+	client.MustPublish(
+		ctx,
+		message.MustNew(sub.Topic, shared.TestData),
+		message.MustNew(sub.Topic, shared.TestData),
+	)
+
+	msgs, err := sub.Fetch(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+
+	assert.NoError(t, client.Unsubscribe(ctx, sub))
+	assert.Equal(t, 0, client.(*NATS).Client.NumSubscriptions())
+
+	_, err = sub.Next(ctx)
+	assert.Error(t, err)
+}
+
+func TestNATS_selfUnsubscribe(t *testing.T) {
+	if !shared.IsEnvironment(shared.Integration) {
+		t.Skip("Skipping test. Not in e2e " + shared.Integration + "environment.")
+	}
+
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	host := os.Getenv("NATS_HOST")
+
+	if host == "" {
+		t.Fatal("NATS_HOST is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	client, err := New(ctx, host)
+	assert.NoError(t, err)
+
+	defer client.Close()
+
+	unsubscribed := make(chan error, 1)
+
+	var sub *subscription.Subscription
+
+	sub = subscription.MustNew("v1.meta.deleted", "v1.meta.deleted.queue", func(msg *message.Message) {
+		unsubscribed <- client.Unsubscribe(ctx, sub)
+	}, subscription.WithChannel(1, subscription.OverflowDropNewest))
+
+	client.MustSubscribe(ctx, sub)
+	client.MustPublish(ctx, message.MustNew(sub.Topic, shared.TestData))
+
+	// Handlers can unsubscribe their own subscription, without deadlocking.
+	select {
+	case err := <-unsubscribed:
+		assert.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("unsubscribing from the handler deadlocked")
+	}
+
+	// The channel is closed once the delivery is done.
+	for range sub.Channel {
+	}
+
+	assert.Equal(t, status.Stopped, sub.Status)
+}
@@ -0,0 +1,4 @@
+// Package outbox provides a transactional outbox: messages are written into a
+// SQL table within the caller transaction, and relayed, by a poller, to any
+// pubsub, so they are published if, and only if, the transaction commits.
+package outbox
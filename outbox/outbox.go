@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/dialect"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/sqlutil"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// DefaultTable is the default outbox table.
+const DefaultTable = "pubsub_outbox"
+
+// Outbox writes messages into `Table`, within the caller transaction, to be
+// relayed, see `Relay`.
+type Outbox struct {
+	// DB is the database.
+	DB *sql.DB
+
+	// Dialect of the database.
+	Dialect *dialect.Dialect
+
+	// Table storing the messages.
+	Table string
+}
+
+//////
+// Helpers.
+//////
+
+// sqlError returns the error used when a query fails.
+func sqlError(table string, err error) error {
+	return sqlutil.Error(errorcatalog.PubSubErrOutboxSQL, table, err)
+}
+
+//////
+// Methods.
+//////
+
+// Write writes `msgs` into the outbox within `tx`, so they are relayed only if
+// it commits. Messages are relayed in the order the database sequences them,
+// so in order per topic for a single writer. Transactions of concurrent
+// writers may commit out of sequence order, relaying their messages out of
+// order. Message IDs are unique: writing a message twice fails.
+func (o *Outbox) Write(ctx context.Context, tx *sql.Tx, msgs ...*message.Message) error {
+	query := o.Dialect.Insert(o.Table, "id", "topic", "message", "headers", "sent_at")
+
+	for _, msg := range msgs {
+		m, err := shared.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		h, err := shared.Marshal(msg.Headers)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, query, msg.ID, msg.Topic, string(m), string(h), 0); err != nil {
+			return sqlError(o.Table, err)
+		}
+	}
+
+	return nil
+}
+
+// Purge deletes the messages relayed before `before`.
+func (o *Outbox) Purge(ctx context.Context, before time.Time) error {
+	if _, err := o.DB.ExecContext(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE sent_at > 0 AND sent_at < %s", o.Table, o.Dialect.Placeholder(1)),
+		before.UnixNano(),
+	); err != nil {
+		return sqlError(o.Table, err)
+	}
+
+	return nil
+}
+
+//////
+// Factory.
+//////
+
+// New creates an outbox stored in `table` (defaults to `DefaultTable`), of a
+// database of dialect `d` (defaults to `dialect.SQLite`), creating it, if
+// needed. Messages are sequenced by the database, see `Write`. `table` isn't
+// escaped, it shouldn't come from user input.
+func New(ctx context.Context, db *sql.DB, d *dialect.Dialect, table string) (*Outbox, error) {
+	if d == nil {
+		d = dialect.SQLite
+	}
+
+	if table == "" {
+		table = DefaultTable
+	}
+
+	o := &Outbox{
+		DB:      db,
+		Dialect: d,
+		Table:   table,
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (seq %s, id VARCHAR(255) NOT NULL UNIQUE, topic VARCHAR(255) NOT NULL, message TEXT NOT NULL, headers TEXT NOT NULL, sent_at BIGINT NOT NULL)",
+		table, d.AutoIncrement,
+	)); err != nil {
+		return nil, sqlError(table, err)
+	}
+
+	return o, nil
+}
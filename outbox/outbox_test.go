@@ -0,0 +1,271 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/dialect"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/memory"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// count returns the amount of rows in the outbox, sent or not.
+func count(t *testing.T, o *Outbox, where string) int {
+	t.Helper()
+
+	var n int
+
+	assert.NoError(t, o.DB.QueryRow("SELECT COUNT(*) FROM "+o.Table+" WHERE "+where).Scan(&n))
+
+	return n
+}
+
+// write writes `msgs` in a transaction, committing it, or not.
+func write(t *testing.T, o *Outbox, commit bool, msgs ...*message.Message) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	tx, err := o.DB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, o.Write(ctx, tx, msgs...))
+
+	if commit {
+		assert.NoError(t, tx.Commit())
+	} else {
+		assert.NoError(t, tx.Rollback())
+	}
+}
+
+func TestRelay(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	o, err := New(ctx, db, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTable, o.Table)
+
+	client, err := memory.New(ctx)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	// Fails to publish "2" until allowed.
+	var allowed atomic.Bool
+
+	errUnavailable := errors.New("unavailable")
+
+	client.(*memory.Memory).PublishMiddlewares = []pubsub.PublishMiddleware{
+		func(next pubsub.PublishHandler) pubsub.PublishHandler {
+			return func(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+				if msg.Data == "2" && !allowed.Load() {
+					return msg, errUnavailable
+				}
+
+				return next(ctx, msg, o)
+			}
+		},
+	}
+
+	created := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+	updated := subscription.MustNew("v1.meta.updated", "v1.meta.updated.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{created, updated}, pubsub.WithSync(true))
+	require.Empty(t, errs)
+
+	r := NewRelay(o, client)
+
+	// Rolled back, never relayed.
+	write(t, o, false, message.MustNew(created.Topic, "0"))
+
+	relayed, err := r.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, relayed)
+
+	first := message.MustNew(created.Topic, "1")
+	first.SetHeader("Tenant", "acme")
+
+	write(
+		t, o, true,
+		first,
+		message.MustNew(created.Topic, "2"),
+		message.MustNew(updated.Topic, "other"),
+		message.MustNew(created.Topic, "3"),
+	)
+
+	// "3" waits for "2", other topics don't.
+	relayed, err = r.Relay(ctx)
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 2, relayed)
+	assert.Equal(t, 2, count(t, o, "sent_at = 0"))
+	assert.Equal(t, int64(1), r.GetRelayFailedCounter().Value())
+
+	allowed.Store(true)
+
+	relayed, err = r.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, relayed)
+	assert.Equal(t, 0, count(t, o, "sent_at = 0"))
+	assert.Equal(t, int64(4), r.GetRelayedCounter().Value())
+
+	msgs, err := created.Fetch(ctx, 3)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	for i, want := range []string{"1", "2", "3"} {
+		assert.Equal(t, want, msgs[i].Data)
+	}
+
+	assert.Equal(t, first.ID, msgs[0].ID)
+	assert.Equal(t, "acme", msgs[0].GetHeader("Tenant"))
+
+	msg, err := updated.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "other", msg.Data)
+
+	// Message IDs are unique.
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	assert.Error(t, o.Write(ctx, tx, first))
+	assert.NoError(t, tx.Rollback())
+
+	assert.NoError(t, o.Purge(ctx, time.Now()))
+	assert.Equal(t, 0, count(t, o, "1 = 1"))
+}
+
+func TestRelay_starvation(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	o, err := New(ctx, db, nil, "")
+	require.NoError(t, err)
+
+	client, err := memory.New(ctx)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	failing := subscription.MustNew("v1.meta.failing", "v1.meta.failing.queue", nil)
+	healthy := subscription.MustNew("v1.meta.healthy", "v1.meta.healthy.queue", nil)
+
+	errUnavailable := errors.New("unavailable")
+
+	// Publishing to the failing topic always fails.
+	client.(*memory.Memory).PublishMiddlewares = []pubsub.PublishMiddleware{
+		func(next pubsub.PublishHandler) pubsub.PublishHandler {
+			return func(ctx context.Context, msg *message.Message, o *pubsub.Options) (*message.Message, error) {
+				if msg.Topic == failing.Topic {
+					return msg, errUnavailable
+				}
+
+				return next(ctx, msg, o)
+			}
+		},
+	}
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{healthy}, pubsub.WithSync(true))
+	require.Empty(t, errs)
+
+	r := NewRelay(o, client)
+	r.BatchSize = 2
+
+	// The failing topic fills the first batches.
+	write(
+		t, o, true,
+		message.MustNew(failing.Topic, "1"),
+		message.MustNew(failing.Topic, "2"),
+		message.MustNew(failing.Topic, "3"),
+		message.MustNew(healthy.Topic, "1"),
+		message.MustNew(healthy.Topic, "2"),
+	)
+
+	// Other topics still make progress.
+	relayed, err := r.Relay(ctx)
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 2, relayed)
+	assert.Equal(t, 3, count(t, o, "sent_at = 0"))
+	assert.Equal(t, int64(1), r.GetRelayFailedCounter().Value())
+
+	msgs, err := healthy.Fetch(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+}
+
+func TestRelay_Run(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	o, err := New(ctx, db, dialect.SQLite, "events_outbox")
+	require.NoError(t, err)
+
+	client, err := memory.New(ctx)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	sub := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+
+	_, errs := client.Subscribe(ctx, []*subscription.Subscription{sub}, pubsub.WithSync(true))
+	require.Empty(t, errs)
+
+	r := NewRelay(o, client)
+	r.BatchSize = 2
+	r.Interval = 10 * time.Millisecond
+
+	runCtx, stop := context.WithCancel(ctx)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		r.Run(runCtx)
+	}()
+
+	write(
+		t, o, true,
+		message.MustNew(sub.Topic, "1"),
+		message.MustNew(sub.Topic, "2"),
+		message.MustNew(sub.Topic, "3"),
+	)
+
+	msgs, err := sub.Fetch(ctx, 3)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	stop()
+	<-done
+}
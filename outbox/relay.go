@@ -0,0 +1,239 @@
+package outbox
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/metrics"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/pubsub"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Default relay settings.
+const (
+	DefaultBatchSize = 100
+	DefaultInterval  = time.Second
+)
+
+// row is an unsent outbox row.
+type row struct {
+	seq     int64
+	id      string
+	topic   string
+	message string
+	headers string
+}
+
+// Relay polls the outbox, publishing the unsent messages through `PubSub`, in
+// sequence order, so in order per topic for a single writer, see
+// `Outbox.Write`, and marks them sent. Messages are published at least once:
+// they are published again if they can't be marked, or if relayed by
+// concurrent relays, so consumers should deduplicate them, see `dedup`.
+type Relay struct {
+	// BatchSize is the maximum amount of messages relayed per poll.
+	BatchSize int
+
+	// Interval between polls.
+	Interval time.Duration
+
+	// Options used to publish.
+	Options []pubsub.Func
+
+	// Outbox to relay.
+	Outbox *Outbox
+
+	// PubSub to publish to.
+	PubSub pubsub.IPubSub
+
+	// Metrics.
+	counterRelayed     *expvar.Int
+	counterRelayFailed *expvar.Int
+}
+
+//////
+// Helpers.
+//////
+
+// unsent returns up to `BatchSize` unsent rows, in order, after `seq`.
+func (r *Relay) unsent(ctx context.Context, seq int64) ([]row, error) {
+	o := r.Outbox
+
+	rows, err := o.DB.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT seq, id, topic, message, headers FROM %s WHERE sent_at = 0 AND seq > %s ORDER BY seq LIMIT %s",
+			o.Table, o.Dialect.Placeholder(1), o.Dialect.Placeholder(2),
+		),
+		seq, r.BatchSize,
+	)
+	if err != nil {
+		return nil, sqlError(o.Table, err)
+	}
+
+	defer rows.Close()
+
+	var unsent []row
+
+	for rows.Next() {
+		var rw row
+
+		if err := rows.Scan(&rw.seq, &rw.id, &rw.topic, &rw.message, &rw.headers); err != nil {
+			return nil, sqlError(o.Table, err)
+		}
+
+		unsent = append(unsent, rw)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, sqlError(o.Table, err)
+	}
+
+	return unsent, nil
+}
+
+// publish decodes, and publishes `rw`.
+func (r *Relay) publish(ctx context.Context, rw row) error {
+	msg := &message.Message{}
+
+	if err := shared.Unmarshal([]byte(rw.message), msg); err != nil {
+		return err
+	}
+
+	if err := shared.Unmarshal([]byte(rw.headers), &msg.Headers); err != nil {
+		return err
+	}
+
+	if _, errs := r.PubSub.Publish(ctx, []*message.Message{msg}, r.Options...); len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+//////
+// Methods.
+//////
+
+// GetRelayedCounter returns the metric.
+func (r *Relay) GetRelayedCounter() *expvar.Int {
+	return r.counterRelayed
+}
+
+// GetRelayFailedCounter returns the metric.
+func (r *Relay) GetRelayFailedCounter() *expvar.Int {
+	return r.counterRelayFailed
+}
+
+// Relay relays up to `BatchSize` unsent messages, returning how many were
+// relayed. Once a message of a topic fails to be published, the following
+// ones, of the same topic, are left for the next poll, keeping them in order.
+// Unsent messages are paged through, so topics failing don't starve the
+// others. It fails with the first failure.
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	var (
+		firstErr error
+		relayed  int
+		seq      int64
+	)
+
+	failed := map[string]bool{}
+
+	for relayed < r.BatchSize {
+		unsent, err := r.unsent(ctx, seq)
+		if err != nil {
+			return relayed, customapm.TraceError(ctx, err, r.PubSub.GetLogger(), nil)
+		}
+
+		for _, rw := range unsent {
+			if relayed >= r.BatchSize {
+				break
+			}
+
+			seq = rw.seq
+
+			if failed[rw.topic] {
+				continue
+			}
+
+			if err := r.publish(ctx, rw); err != nil {
+				failed[rw.topic] = true
+
+				err = customapm.TraceError(ctx, err, r.PubSub.GetLogger(), r.counterRelayFailed)
+
+				if firstErr == nil {
+					firstErr = err
+				}
+
+				continue
+			}
+
+			if _, err := r.Outbox.DB.ExecContext(
+				ctx,
+				fmt.Sprintf("UPDATE %s SET sent_at = %s WHERE id = %s", r.Outbox.Table, r.Outbox.Dialect.Placeholder(1), r.Outbox.Dialect.Placeholder(2)),
+				time.Now().UnixNano(), rw.id,
+			); err != nil {
+				return relayed, customapm.TraceError(ctx, sqlError(r.Outbox.Table, err), r.PubSub.GetLogger(), nil)
+			}
+
+			r.counterRelayed.Add(1)
+
+			relayed++
+		}
+
+		// Last page.
+		if len(unsent) < r.BatchSize {
+			break
+		}
+	}
+
+	return relayed, firstErr
+}
+
+// Run relays unsent messages every `Interval`, until `ctx` is done. Full
+// batches are relayed right away. Failures are logged, and retried on the next
+// poll.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		relayed, _ := r.Relay(ctx)
+
+		if relayed >= r.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//////
+// Factory.
+//////
+
+// NewRelay creates a relay of `o` to `p`, polling up to `DefaultBatchSize`
+// messages every `DefaultInterval`, unless set.
+func NewRelay(o *Outbox, p pubsub.IPubSub, opts ...pubsub.Func) *Relay {
+	return &Relay{
+		BatchSize: DefaultBatchSize,
+		Interval:  DefaultInterval,
+		Options:   opts,
+		Outbox:    o,
+		PubSub:    p,
+
+		counterRelayed:     metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", "outbox", o.Table, "relayed", pubsub.DefaultMetricCounterLabel)),
+		counterRelayFailed: metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", "outbox", o.Table, "relay.failed", pubsub.DefaultMetricCounterLabel)),
+	}
+}
@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// acker acknowledges a delivered message with the pubsub implementation
+// acker, counting each outcome. A message is settled (acked, nacked, or
+// terminated) once, later settlements are no-ops.
+type acker struct {
+	p     *PubSub
+	acker message.Acker
+
+	mu      sync.Mutex
+	settled bool
+}
+
+//////
+// Helpers.
+//////
+
+// settle settles the message with `fn`, if not already.
+func (a *acker) settle(fn func() error) error {
+	if a.acker == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.settled {
+		return nil
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	a.settled = true
+
+	return nil
+}
+
+// newAcker wraps the acker of `e`, if any.
+func (p *PubSub) newAcker(e *Envelope) *acker {
+	return &acker{p: p, acker: e.Acker}
+}
+
+//////
+// Implements the message.Acker interface.
+//////
+
+// Ack acknowledges the message was handled.
+func (a *acker) Ack(ctx context.Context) error {
+	return a.settle(func() error {
+		if err := a.acker.Ack(ctx); err != nil {
+			return err
+		}
+
+		a.p.counterAcked.Add(1)
+
+		return nil
+	})
+}
+
+// Nack signals the message handling failed, so it's redelivered after `delay`.
+func (a *acker) Nack(ctx context.Context, delay time.Duration) error {
+	return a.settle(func() error {
+		if err := a.acker.Nack(ctx, delay); err != nil {
+			return err
+		}
+
+		a.p.counterNacked.Add(1)
+
+		return nil
+	})
+}
+
+// InProgress signals the message is still being handled.
+func (a *acker) InProgress(ctx context.Context) error {
+	if a.acker == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.settled {
+		return nil
+	}
+
+	if err := a.acker.InProgress(ctx); err != nil {
+		return err
+	}
+
+	a.p.counterInProgress.Add(1)
+
+	return nil
+}
+
+// Term signals the message can't be handled, so it's never redelivered.
+func (a *acker) Term(ctx context.Context) error {
+	return a.settle(func() error {
+		if err := a.acker.Term(ctx); err != nil {
+			return err
+		}
+
+		a.p.counterTerminated.Add(1)
+
+		return nil
+	})
+}
@@ -0,0 +1,683 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/signing"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/sypl"
+	"github.com/thalesfsp/sypl/fields"
+	"github.com/thalesfsp/sypl/level"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Headers set by the pubsub when routing messages, e.g.: to poison topics.
+const (
+	// HeaderAttempts is the amount of times the message handling was
+	// attempted.
+	HeaderAttempts = "Pubsub-Attempts"
+
+	// HeaderError is the error which caused the message to be routed.
+	HeaderError = "Pubsub-Error"
+
+	// HeaderFailedAt is when the message handling last failed, in RFC 3339
+	// format.
+	HeaderFailedAt = "Pubsub-Failed-At"
+
+	// HeaderTopic is the topic the message was originally published to.
+	HeaderTopic = "Pubsub-Topic"
+)
+
+//////
+// Helpers.
+//////
+
+// handle runs the subscription handler functions, wrapped by the middlewares,
+// bounded by the subscription timeout, if any.
+func (p *PubSub) handle(ctx context.Context, s *subscription.Subscription, msg *message.Message) error {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	return p.chain(s, func(ctx context.Context, msg *message.Message) error {
+		if s.Func != nil {
+			s.Func(msg)
+		}
+
+		if s.Handler == nil {
+			return nil
+		}
+
+		return s.Handler(ctx, msg)
+	})(ctx, msg)
+}
+
+// safeHandle runs `handle`, recovering from panics, which are converted into
+// errors carrying the stack trace.
+func (p *PubSub) safeHandle(ctx context.Context, s *subscription.Subscription, msg *message.Message) (panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			opts := []customerror.Option{
+				customerror.WithField("panic", fmt.Sprint(r)),
+				customerror.WithField("stack", string(debug.Stack())),
+				customerror.WithField("topic", s.Topic),
+				customerror.WithField("id", msg.ID),
+			}
+
+			if rErr, ok := r.(error); ok {
+				opts = append(opts, customerror.WithError(rErr))
+			}
+
+			panicked = true
+			err = errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrPubSubPanic).
+				NewFailedToError(opts...)
+		}
+	}()
+
+	return false, p.handle(ctx, s, msg)
+}
+
+// toChannel sends `msg` to the subscription channel, if any, according to the
+// subscription overflow policy.
+func (p *PubSub) toChannel(ctx context.Context, s *subscription.Subscription, msg *message.Message) error {
+	if s.Channel == nil {
+		return nil
+	}
+
+	overflow := s.Overflow
+
+	// Unbuffered channels hold nothing to drop, so the newest is dropped.
+	if overflow == subscription.OverflowDropOldest && cap(s.Channel) == 0 {
+		overflow = subscription.OverflowDropNewest
+	}
+
+	switch overflow {
+	case subscription.OverflowDropNewest:
+		select {
+		case s.Channel <- msg:
+		default:
+			p.counterChannelDropped.Add(1)
+		}
+	case subscription.OverflowDropOldest:
+		for {
+			select {
+			case s.Channel <- msg:
+				return nil
+			default:
+			}
+
+			select {
+			case <-s.Channel:
+				p.counterChannelDropped.Add(1)
+			default:
+				// Drained meanwhile, retries delivering.
+			}
+		}
+	case subscription.OverflowError:
+		select {
+		case s.Channel <- msg:
+		default:
+			return customapm.TraceError(
+				ctx,
+				errorcatalog.
+					Get().
+					MustGet(errorcatalog.PubSubErrSubscriptionFull).
+					NewFailedToError(
+						customerror.WithField("topic", s.Topic),
+						customerror.WithField("id", msg.ID),
+					),
+				p.GetLogger(),
+				p.counterChannelDropped,
+			)
+		}
+	default:
+		select {
+		case s.Channel <- msg:
+		case <-ctx.Done():
+		}
+	}
+
+	return nil
+}
+
+// deadLetter routes `msg`, which handling failed with `cause` after
+// `attempts`, to the subscription dead letter topic. The received envelope
+// `e`, if any, is forwarded as is, so its payload is still described by its
+// headers, e.g.: compressed, or encrypted, otherwise `msg` is encoded.
+func (p *PubSub) deadLetter(
+	ctx context.Context,
+	s *subscription.Subscription,
+	msg *message.Message,
+	e *Envelope,
+	cause error,
+	attempts int,
+) error {
+	if p.Sender == nil {
+		return nil
+	}
+
+	if e != nil {
+		e = &Envelope{
+			Headers: copyHeaders(e.Headers),
+			Payload: e.Payload,
+		}
+	} else {
+		var err error
+
+		if e, err = p.Encode(ctx, msg, nil); err != nil {
+			return err
+		}
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+
+	e.Headers[HeaderAttempts] = strconv.Itoa(attempts)
+	e.Headers[HeaderError] = cause.Error()
+	e.Headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	e.Headers[HeaderTopic] = s.Topic
+	e.Topic = s.DeadLetterTopic
+
+	// Signed for the topic it's routed to.
+	if err := p.sign(e); err != nil {
+		return err
+	}
+
+	if err := p.Sender(ctx, s.DeadLetterTopic, e); err != nil {
+		return err
+	}
+
+	p.counterDeadLettered.Add(1)
+
+	return nil
+}
+
+// run runs the subscription handler functions, recovering from panics, which
+// are redelivered according to the subscription panic policy.
+func (p *PubSub) run(ctx context.Context, s *subscription.Subscription, msg *message.Message) (bool, error) {
+	attempts := 1
+
+	if s.PanicPolicy == subscription.PanicRedeliver {
+		attempts += s.MaxRedeliveries
+	}
+
+	var (
+		err      error
+		panicked bool
+	)
+
+	for attempt := 1; ; attempt++ {
+		panicked, err = p.safeHandle(ctx, s, msg)
+		if panicked {
+			p.counterHandlerPanicked.Add(1)
+		}
+
+		if !panicked || attempt >= attempts || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		err = customapm.TraceError(ctx, err, p.GetLogger(), p.GetSubscribedFailedCounter())
+	}
+
+	return panicked, err
+}
+
+// attempt runs the subscription handler functions, retrying failures, in
+// process, waiting `backoff`, randomized by `jitter`, before each retry. It
+// returns the amount of attempts.
+func (p *PubSub) attempt(
+	ctx context.Context,
+	s *subscription.Subscription,
+	msg *message.Message,
+	backoff []time.Duration,
+	jitter float64,
+) (int, bool, error) {
+	var (
+		attempts int
+		err      error
+		panicked bool
+	)
+
+	r := retrier.New(backoff, nil)
+	r.SetJitter(jitter)
+
+	// Fails only if `ctx` is done while waiting, then the last failure is
+	// reported.
+	_ = r.RunCtx(ctx, func(ctx context.Context) error {
+		attempts++
+
+		if attempts > 1 {
+			p.counterRetried.Add(1)
+
+			p.GetLogger().PrintlnWithOptions(
+				level.Warn,
+				"retrying",
+				sypl.WithFields(logging.ToAPM(ctx, fields.Fields{"attempt": attempts, "error": err.Error()})),
+			)
+		}
+
+		panicked, err = p.run(ctx, s, msg)
+
+		return err
+	})
+
+	if attempts > 1 {
+		if err != nil {
+			p.counterRetryExhausted.Add(1)
+
+			p.GetLogger().PrintlnWithOptions(
+				level.Error,
+				"retries exhausted",
+				sypl.WithFields(logging.ToAPM(ctx, fields.Fields{"attempts": attempts, "error": err.Error()})),
+			)
+		} else {
+			p.counterRetrySucceeded.Add(1)
+
+			p.GetLogger().PrintlnWithOptions(
+				level.Info,
+				"retry succeeded",
+				sypl.WithFields(logging.ToAPM(ctx, fields.Fields{"attempts": attempts})),
+			)
+		}
+	}
+
+	return attempts, panicked, err
+}
+
+// duplicate returns if `msg` key is recorded in the subscription dedup store,
+// if any, so it's skipped. Messages are delivered if the store fails.
+func (p *PubSub) duplicate(ctx context.Context, s *subscription.Subscription, msg *message.Message) bool {
+	if s.Dedup == nil {
+		return false
+	}
+
+	exists, err := s.Dedup.Exists(ctx, s.DedupKey(msg))
+	if err != nil {
+		_ = customapm.TraceError(ctx, err, p.GetLogger(), nil)
+
+		return false
+	}
+
+	if exists {
+		p.counterDeduplicated.Add(1)
+
+		p.GetLogger().PrintlnWithOptions(
+			level.Debug,
+			"duplicate skipped",
+			sypl.WithFields(logging.ToAPM(ctx, fields.Fields{"id": msg.ID})),
+		)
+	}
+
+	return exists
+}
+
+// record records `msg` key in the subscription dedup store, if any.
+func (p *PubSub) record(ctx context.Context, s *subscription.Subscription, msg *message.Message) {
+	if s.Dedup == nil {
+		return
+	}
+
+	if err := s.Dedup.Add(ctx, s.DedupKey(msg)); err != nil {
+		_ = customapm.TraceError(ctx, err, p.GetLogger(), nil)
+	}
+}
+
+// deliver implements `Deliver`. `msg` is decoded from `e`, if received.
+// `attempt` is the delivery attempt of `msg`, as counted by the pubsub
+// implementation, zero if it doesn't redeliver, then the message is
+// dead-lettered, if enabled, once in process retries are exhausted.
+func (p *PubSub) deliver(
+	ctx context.Context,
+	s *subscription.Subscription,
+	msg *message.Message,
+	e *Envelope,
+	attempt int,
+) error {
+	// Correlates the transaction, and log, and logs it.
+	p.GetLogger().PrintlnWithOptions(
+		level.Debug,
+		"received",
+		sypl.WithFields(logging.ToAPM(ctx, make(fields.Fields))),
+	)
+
+	if p.duplicate(ctx, s, msg) {
+		return nil
+	}
+
+	var (
+		backoff []time.Duration
+		jitter  float64
+	)
+
+	switch {
+	case s.Retry != nil:
+		backoff, jitter = s.Retry.Backoff, s.Retry.Jitter
+	case attempt == 0 && s.MaxAttempts > 1:
+		// Retried immediately, as it isn't redelivered.
+		backoff = make([]time.Duration, s.MaxAttempts-1)
+	}
+
+	attempts, panicked, err := p.attempt(ctx, s, msg, backoff, jitter)
+
+	handled := err == nil
+
+	exhausted := s.MaxAttempts > 0 && attempt >= s.MaxAttempts
+
+	// Not redelivered, so it's the last attempt, unless stopped.
+	if attempt == 0 {
+		attempt = attempts
+		exhausted = s.MaxAttempts > 0 && ctx.Err() == nil
+	}
+
+	if err != nil && (exhausted || (panicked && s.PanicPolicy == subscription.PanicDeadLetter)) {
+		if dlErr := p.deadLetter(ctx, s, msg, e, err, attempt); dlErr != nil {
+			_ = customapm.TraceError(ctx, dlErr, p.GetLogger(), nil)
+		} else {
+			// Done with, so it's not redelivered.
+			err = nil
+		}
+	}
+
+	// Also sends the data to the channel, once handled, so not once per
+	// attempt.
+	if handled {
+		err = p.toChannel(ctx, s, msg)
+	}
+
+	if err == nil {
+		p.record(ctx, s, msg)
+	}
+
+	return err
+}
+
+// verify verifies `e` signature, if its topic has trusted keys, applying the
+// signer policy to envelopes which can't be verified, quarantined ones are
+// routed on behalf of `topic`. It returns whether `e` should be delivered,
+// and fails only if `e` couldn't be quarantined.
+func (p *PubSub) verify(ctx context.Context, topic string, e *Envelope) (bool, error) {
+	if p.Signer == nil {
+		return true, nil
+	}
+
+	err := p.Signer.Verify(e.Topic, e.Headers[HeaderID], e.Headers, e.Payload)
+	if err == nil {
+		return true, nil
+	}
+
+	err = customapm.TraceError(ctx, err, p.GetLogger(), p.counterSignatureUnverified)
+
+	switch p.Signer.Policy() {
+	case signing.PolicyCount:
+		return true, nil
+	case signing.PolicyQuarantine:
+		if p.Sender == nil {
+			return false, nil
+		}
+
+		quarantine := topic + signing.DefaultQuarantineTopicSuffix
+
+		quarantined := &Envelope{
+			Topic:   quarantine,
+			Headers: copyHeaders(e.Headers),
+			Payload: e.Payload,
+		}
+
+		if quarantined.Headers == nil {
+			quarantined.Headers = map[string]string{}
+		}
+
+		quarantined.Headers[HeaderError] = err.Error()
+		quarantined.Headers[HeaderTopic] = topic
+
+		if sendErr := p.Sender(ctx, quarantine, quarantined); sendErr != nil {
+			return false, customapm.TraceError(ctx, sendErr, p.GetLogger(), nil)
+		}
+	}
+
+	return false, nil
+}
+
+// redeliveryDelay returns the wait before redelivering a message which
+// handling failed at `attempt`: the subscription retry policy backoff for the
+// attempt, the last one once exhausted, otherwise `RedeliveryDelay`.
+func (p *PubSub) redeliveryDelay(s *subscription.Subscription, attempt int) time.Duration {
+	if s.Retry == nil || len(s.Retry.Backoff) == 0 {
+		return p.RedeliveryDelay
+	}
+
+	i := attempt - 1
+
+	if i < 0 {
+		i = 0
+	}
+
+	if i >= len(s.Retry.Backoff) {
+		i = len(s.Retry.Backoff) - 1
+	}
+
+	return s.Retry.Backoff[i]
+}
+
+// settle acknowledges a received envelope, with `a`: if `err`, it's
+// redelivered after `delay`, otherwise it's done with. Messages already
+// settled, e.g.: by the handler, are left as is.
+func (p *PubSub) settle(ctx context.Context, a *acker, delay time.Duration, err error) {
+	settle := a.Ack
+
+	if err != nil {
+		settle = func(ctx context.Context) error {
+			return a.Nack(ctx, delay)
+		}
+	}
+
+	if ackErr := settle(ctx); ackErr != nil {
+		_ = customapm.TraceError(ctx, ackErr, p.GetLogger(), nil)
+	}
+}
+
+// discard terminates, with `a`, a received envelope which can't be handled,
+// e.g.: undecodable, so it's never redelivered. If `err`, it couldn't be
+// routed according to the policies, so it's redelivered instead, after
+// `RedeliveryDelay`.
+func (p *PubSub) discard(ctx context.Context, a *acker, err error) {
+	if err != nil {
+		p.settle(ctx, a, p.RedeliveryDelay, err)
+
+		return
+	}
+
+	if ackErr := a.Term(ctx); ackErr != nil {
+		_ = customapm.TraceError(ctx, ackErr, p.GetLogger(), nil)
+	}
+}
+
+// decode decodes `e` into a message for the subscription `s`, including its
+// data, if `s` has a decoder.
+func (p *PubSub) decode(ctx context.Context, s *subscription.Subscription, e *Envelope) (*message.Message, error) {
+	msg, err := p.Decode(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Decoder != nil {
+		if err := s.Decoder(msg); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// decodeFailed applies the subscription decode error policy to `e`, which
+// couldn't be decoded. It fails only if `e` couldn't be poisoned.
+func (p *PubSub) decodeFailed(ctx context.Context, s *subscription.Subscription, e *Envelope, err error) error {
+	err = customapm.TraceError(ctx, err, p.GetLogger(), p.GetSubscribedFailedCounter())
+
+	switch {
+	case s.DecodeErrorPolicy == subscription.DecodeErrorPoison && p.Sender != nil:
+		poison := &Envelope{
+			Topic:   s.PoisonTopic,
+			Headers: copyHeaders(e.Headers),
+			Payload: e.Payload,
+		}
+
+		if poison.Headers == nil {
+			poison.Headers = map[string]string{}
+		}
+
+		poison.Headers[HeaderError] = err.Error()
+		poison.Headers[HeaderTopic] = s.Topic
+
+		if sendErr := p.Sender(ctx, s.PoisonTopic, poison); sendErr != nil {
+			// Can't be routed, so it's dropped, unless redelivered.
+			p.counterDecodeDropped.Add(1)
+
+			return customapm.TraceError(ctx, sendErr, p.GetLogger(), nil)
+		}
+
+		p.counterDecodePoisoned.Add(1)
+	case s.DecodeErrorPolicy == subscription.DecodeErrorHook && s.OnDecodeError != nil:
+		s.OnDecodeError(ctx, e.Payload, copyHeaders(e.Headers), err)
+
+		p.counterDecodeHooked.Add(1)
+	default:
+		p.counterDecodeDropped.Add(1)
+	}
+
+	return nil
+}
+
+//////
+// Exported functionalities.
+//////
+
+// Receive handles an envelope received by the subscription `s`: it continues
+// the publisher's trace, verifies its signature, decodes it, and delivers it
+// (see `Deliver`). If it can't be verified, the signer policy is applied (see
+// `PubSub.Signer`). If it can't be decoded, the subscription decode error
+// policy is applied. It's used by the pubsub implementations, which are
+// responsible for cancelling `ctx` once the subscription is stopped.
+//
+// It only fails if the envelope should be redelivered: its handling failed, or
+// it couldn't be routed according to the policies. Envelopes are acknowledged
+// accordingly, unless the subscription acknowledges them manually: failed
+// ones are redelivered after a delay, see `RedeliveryDelay`.
+func (p *PubSub) Receive(ctx context.Context, s *subscription.Subscription, e *Envelope) error {
+	// Continues the publisher's trace.
+	ctx, tx := customapm.Continue(
+		ctx,
+		e.Headers,
+		s.Topic,
+		fmt.Sprintf("%s.%s", p.GetType(), p.GetName()),
+	)
+	defer tx.End()
+
+	a := p.newAcker(e)
+
+	ok, err := p.verify(ctx, s.Topic, e)
+	if !ok {
+		p.discard(ctx, a, err)
+
+		return err
+	}
+
+	msg, err := p.decode(ctx, s, e)
+	if err != nil {
+		err = p.decodeFailed(ctx, s, e, err)
+
+		p.discard(ctx, a, err)
+
+		return err
+	}
+
+	msg.SetAcker(a)
+
+	err = p.deliver(ctx, s, msg, e, e.Attempt)
+
+	if s.AckMode != subscription.AckManual {
+		p.settle(ctx, a, p.redeliveryDelay(s, e.Attempt), err)
+	}
+
+	return err
+}
+
+// Pull pulls, with `next`, the next envelope received by the synchronous
+// subscription `s`, verifies, and decodes it. Envelopes which can't be
+// verified, or decoded are handled according to the signer policy, or the
+// subscription decode error policy, and skipped. Pulled messages aren't
+// acknowledged, whatever the subscription ack mode, it's up to the caller.
+func (p *PubSub) Pull(
+	ctx context.Context,
+	s *subscription.Subscription,
+	next func(ctx context.Context) (*Envelope, error),
+) (*message.Message, error) {
+	for {
+		e, err := next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		a := p.newAcker(e)
+
+		ok, err := p.verify(ctx, s.Topic, e)
+		if !ok {
+			p.discard(ctx, a, err)
+
+			continue
+		}
+
+		msg, err := p.decode(ctx, s, e)
+		if err != nil {
+			p.discard(ctx, a, p.decodeFailed(ctx, s, e, err))
+
+			continue
+		}
+
+		// Pulled messages are acknowledged by the caller, once handled, so
+		// they're never lost, see `subscription.Subscription.Next`.
+		msg.SetAcker(a)
+
+		return msg, nil
+	}
+}
+
+// Deliver delivers a received message to the subscription: it runs the
+// subscription handler functions, then sends the message to the subscription
+// channel, if any, according to its overflow policy. It's used by the pubsub
+// implementations, which are responsible for cancelling `ctx` once the
+// subscription is stopped.
+//
+// Handler failures are traced, and counted (see `GetSubscribedFailedCounter`),
+// then returned, so implementations supporting redelivery can act on it. If
+// the subscription has a max attempts count, failed handlings are retried, in
+// process, then the message is dead-lettered (see `GetDeadLetteredCounter`),
+// and no longer reported as failed.
+//
+// Handler panics are recovered, counted (see `GetHandlerPanickedCounter`), and
+// handled according to the subscription panic policy, keeping the
+// subscription alive.
+func (p *PubSub) Deliver(ctx context.Context, s *subscription.Subscription, msg *message.Message) error {
+	return p.deliver(ctx, s, msg, nil, 0)
+}
@@ -0,0 +1,36 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_redeliveryDelay(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	p, err := New(context.Background(), "redelivery")
+	assert.NoError(t, err)
+
+	s := subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+
+	// Without a retry policy.
+	assert.Equal(t, DefaultRedeliveryDelay, p.redeliveryDelay(s, 1))
+
+	s = subscription.MustNew("v1.meta.created", "v1.meta.created.queue", nil, subscription.WithRetry(backoff.Exponential(3, time.Second)))
+
+	// The backoff of the attempt, the last one once exhausted.
+	for attempt, want := range map[int]time.Duration{
+		0: time.Second,
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		9: 4 * time.Second,
+	} {
+		assert.Equal(t, want, p.redeliveryDelay(s, attempt))
+	}
+}
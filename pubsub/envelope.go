@@ -0,0 +1,399 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/WreckingBallStudioLabs/pubsub/codec"
+	"github.com/WreckingBallStudioLabs/pubsub/compression"
+	"github.com/WreckingBallStudioLabs/pubsub/encryption"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/signing"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Envelope is a message as transported by the pubsub implementations: the
+// encoded message, and its headers.
+type Envelope struct {
+	// Topic the envelope is published to, or received from.
+	Topic string
+
+	// Headers are the message headers.
+	Headers map[string]string
+
+	// Payload is the encoded message.
+	Payload []byte
+
+	// Respond replies to the envelope. Only set for requests.
+	Respond func(ctx context.Context, reply *Envelope) error
+
+	// Acker acknowledges the envelope. Only set by pubsub implementations
+	// supporting acknowledgements.
+	Acker message.Acker
+
+	// Attempt is the delivery attempt of the envelope, starting at 1. Only set
+	// by pubsub implementations redelivering envelopes.
+	Attempt int
+
+	// Message is the encoded message, a copy of the one given to `Encode`, with
+	// its ID, and headers as published. Only set by `Encode`.
+	Message *message.Message
+}
+
+// SendFunc sends an envelope, as is, to a topic.
+type SendFunc func(ctx context.Context, topic string, e *Envelope) error
+
+// HeaderID is the ID of the enveloped message, so it's signed, and verified
+// before decoding.
+const HeaderID = "Pubsub-Id"
+
+// pipelineHeaders are the headers owned by the encoding pipeline, describing
+// an envelope payload. They're never part of messages, otherwise republishing
+// a received message would describe its new payload with stale ones.
+var pipelineHeaders = []string{
+	HeaderID,
+	codec.ContentTypeHeader,
+	compression.ContentEncodingHeader,
+	encryption.KeyIDHeader,
+	signing.KeyIDHeader,
+	signing.SignatureHeader,
+}
+
+//////
+// Helpers.
+//////
+
+// copyHeaders copies `headers`, so publishers, and subscribers don't share
+// them.
+func copyHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(headers))
+
+	for k, v := range headers {
+		c[k] = v
+	}
+
+	return c
+}
+
+// messageHeaders copies `headers`, without the pipeline ones.
+func messageHeaders(headers map[string]string) map[string]string {
+	c := copyHeaders(headers)
+
+	for _, k := range pipelineHeaders {
+		delete(c, k)
+	}
+
+	if len(c) == 0 {
+		return nil
+	}
+
+	return c
+}
+
+// compress compresses `e` payload, according to `o`, if any, otherwise to the
+// pubsub compression. It's recorded in the `compression.ContentEncodingHeader`
+// header.
+func (p *PubSub) compress(e *Envelope, o *Options) error {
+	c, threshold := p.Compressor, p.CompressionThreshold
+
+	if o != nil && o.Compressor != nil {
+		c, threshold = o.Compressor, o.CompressionThreshold
+	}
+
+	if c == nil || len(e.Payload) < threshold {
+		return nil
+	}
+
+	payload, err := c.Compress(e.Payload)
+	if err != nil {
+		return err
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+
+	e.Headers[compression.ContentEncodingHeader] = c.Encoding()
+	e.Payload = payload
+
+	return nil
+}
+
+// encrypt encrypts `e` payload, if its topic is configured to be encrypted. The
+// key ID is recorded in the `encryption.KeyIDHeader` header.
+func (p *PubSub) encrypt(ctx context.Context, e *Envelope) error {
+	if p.Encryptor == nil {
+		return nil
+	}
+
+	payload, id, err := p.Encryptor.Encrypt(ctx, e.Topic, e.Payload)
+	if err != nil {
+		return err
+	}
+
+	if id == "" {
+		return nil
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+
+	e.Headers[encryption.KeyIDHeader] = id
+	e.Payload = payload
+
+	return nil
+}
+
+// decrypt decrypts `payload` of `e`, with the key recorded in the
+// `encryption.KeyIDHeader` header, if any. Plaintext ones received from a
+// topic configured to be encrypted are rejected, and counted, otherwise
+// anyone able to publish could bypass encryption.
+func (p *PubSub) decrypt(ctx context.Context, e *Envelope, payload []byte) ([]byte, error) {
+	id := e.Headers[encryption.KeyIDHeader]
+	if id == "" {
+		if p.Encryptor != nil && p.Encryptor.Covers(e.Topic) {
+			p.counterPlaintextRejected.Add(1)
+
+			return nil, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrEncryptionPlaintext).
+				NewFailedToError(
+					customerror.WithField("topic", e.Topic),
+					customerror.WithField("id", e.Headers[HeaderID]),
+				)
+		}
+
+		return payload, nil
+	}
+
+	if p.Encryptor == nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrEncryptionKeyNotFound).
+			NewFailedToError(
+				customerror.WithField("topic", e.Topic),
+				customerror.WithField("keyID", id),
+			)
+	}
+
+	return p.Encryptor.Decrypt(ctx, e.Topic, id, payload)
+}
+
+// sign signs `e` topic, message ID, headers, and payload, if its topic is
+// configured to be signed. Previous signatures, e.g.: of a forwarded envelope,
+// are removed. The key ID, and the signature are recorded in the
+// `signing.KeyIDHeader`, and `signing.SignatureHeader` headers.
+func (p *PubSub) sign(e *Envelope) error {
+	if p.Signer == nil {
+		return nil
+	}
+
+	delete(e.Headers, signing.KeyIDHeader)
+	delete(e.Headers, signing.SignatureHeader)
+
+	id, signature, err := p.Signer.Sign(e.Topic, e.Headers[HeaderID], e.Headers, e.Payload)
+	if err != nil {
+		return err
+	}
+
+	if id == "" {
+		return nil
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+
+	e.Headers[signing.KeyIDHeader] = id
+	e.Headers[signing.SignatureHeader] = signature
+
+	return nil
+}
+
+// decompress decompresses `e` payload, with the compressor recorded in the
+// `compression.ContentEncodingHeader` header, if any, up to
+// `PubSub.MaxDecompressedSize`.
+func (p *PubSub) decompress(e *Envelope, payload []byte) ([]byte, error) {
+	encoding := e.Headers[compression.ContentEncodingHeader]
+	if encoding == "" {
+		return payload, nil
+	}
+
+	c, err := compression.Get(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Decompress(payload, p.MaxDecompressedSize)
+}
+
+//////
+// Exported functionalities.
+//////
+
+// Encode encodes a copy of `msg` into an envelope, propagating the trace found
+// in `ctx`. `msg` isn't modified, so it's safe to publish concurrently, the
+// copy is the envelope `Message`. Its ID is derived from its content, if set
+// in `o`, see `WithContentID`, and recorded in the `HeaderID` header. The
+// codec is the one set in `o`, if any, otherwise the pubsub one. It's recorded
+// in the `codec.ContentTypeHeader` header. Payloads are compressed the same
+// way, see `WithCompression`, then encrypted if the topic is configured to be,
+// see `PubSub.Encryptor`, and finally signed, see `PubSub.Signer`.
+func (p *PubSub) Encode(ctx context.Context, msg *message.Message, o *Options) (*Envelope, error) {
+	c := p.Codec
+
+	if o != nil && o.Codec != nil {
+		c = o.Codec
+	}
+
+	if c == nil {
+		c = codec.Default
+	}
+
+	m := *msg
+
+	// Never shares `msg` headers, publishers may reuse them concurrently. The
+	// pipeline ones, e.g.: of a received message, are set below if needed.
+	m.Headers = messageHeaders(msg.Headers)
+
+	if o != nil && o.ContentID {
+		id, err := m.ContentID()
+		if err != nil {
+			return nil, err
+		}
+
+		m.ID = id
+	}
+
+	m.Headers = customapm.Inject(ctx, m.Headers)
+
+	payload, err := c.Marshal(&m)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Envelope{
+		Topic:   m.Topic,
+		Headers: copyHeaders(m.Headers),
+		Payload: payload,
+		Message: &m,
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+
+	e.Headers[codec.ContentTypeHeader] = c.ContentType()
+
+	if m.ID != "" {
+		e.Headers[HeaderID] = m.ID
+	}
+
+	if err := p.compress(e, o); err != nil {
+		return nil, err
+	}
+
+	if err := p.encrypt(ctx, e); err != nil {
+		return nil, err
+	}
+
+	if err := p.sign(e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Decode decodes `e` into a message, with the codec recorded in the
+// `codec.ContentTypeHeader` header, decrypting, and decompressing it first if
+// needed. The pipeline headers, e.g.: `compression.ContentEncodingHeader`, are
+// left out of the message headers. If `e` is a request, the message can be replied, see
+// `message.Respond`.
+func (p *PubSub) Decode(ctx context.Context, e *Envelope) (*message.Message, error) {
+	payload, err := p.decrypt(ctx, e, e.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err = p.decompress(e, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := codec.Get(e.Headers[codec.ContentTypeHeader])
+	if err != nil {
+		return nil, err
+	}
+
+	var msg message.Message
+
+	if err := c.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+
+	// The envelope ID is the verified one.
+	if id := e.Headers[HeaderID]; id != "" {
+		if msg.ID != "" && msg.ID != id {
+			return nil, errorcatalog.
+				Get().
+				MustGet(errorcatalog.PubSubErrPubSubIDMismatch).
+				NewFailedToError(
+					customerror.WithField("topic", e.Topic),
+					customerror.WithField("id", msg.ID),
+					customerror.WithField("envelopeID", id),
+				)
+		}
+
+		msg.ID = id
+	}
+
+	msg.Headers = messageHeaders(e.Headers)
+
+	if e.Respond != nil {
+		msg.SetResponder(func(ctx context.Context, reply *message.Message) error {
+			r, err := p.Encode(ctx, reply, nil)
+			if err != nil {
+				return err
+			}
+
+			return e.Respond(ctx, r)
+		})
+	}
+
+	return &msg, nil
+}
+
+// DecodeReply decodes `e`, the reply to a request published to `topic`, see
+// `Decode`. Replies are signed for the request topic, so `e` is verified
+// against it first, and rejected if it can't be, unless the signer policy
+// is `signing.PolicyCount`, see `PubSub.Signer`.
+func (p *PubSub) DecodeReply(ctx context.Context, topic string, e *Envelope) (*message.Message, error) {
+	e.Topic = topic
+
+	ok, err := p.verify(ctx, topic, e)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrPubSubUnverifiedReply).
+			NewFailedToError(
+				customerror.WithField("topic", topic),
+				customerror.WithField("id", e.Headers[HeaderID]),
+			)
+	}
+
+	return p.Decode(ctx, e)
+}
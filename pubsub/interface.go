@@ -59,15 +59,72 @@ type IPubSub interface {
 	// GetCounterPingFailed returns the metric.
 	GetCounterPingFailed() *expvar.Int
 
+	// GetAckedCounter returns the metric.
+	GetAckedCounter() *expvar.Int
+
+	// GetBreakerRejectedCounter returns the metric.
+	GetBreakerRejectedCounter() *expvar.Int
+
+	// GetBreakerStateGauge returns the metric.
+	GetBreakerStateGauge() *expvar.Int
+
+	// GetChannelDroppedCounter returns the metric.
+	GetChannelDroppedCounter() *expvar.Int
+
+	// GetDeadLetteredCounter returns the metric.
+	GetDeadLetteredCounter() *expvar.Int
+
+	// GetDecodeDroppedCounter returns the metric.
+	GetDecodeDroppedCounter() *expvar.Int
+
+	// GetDecodeHookedCounter returns the metric.
+	GetDecodeHookedCounter() *expvar.Int
+
+	// GetDecodePoisonedCounter returns the metric.
+	GetDecodePoisonedCounter() *expvar.Int
+
+	// GetDeduplicatedCounter returns the metric.
+	GetDeduplicatedCounter() *expvar.Int
+
+	// GetHandlerPanickedCounter returns the metric.
+	GetHandlerPanickedCounter() *expvar.Int
+
+	// GetInProgressCounter returns the metric.
+	GetInProgressCounter() *expvar.Int
+
+	// GetNackedCounter returns the metric.
+	GetNackedCounter() *expvar.Int
+
+	// GetPlaintextRejectedCounter returns the metric.
+	GetPlaintextRejectedCounter() *expvar.Int
+
+	// GetPublishRetriedCounter returns the metric.
+	GetPublishRetriedCounter() *expvar.Int
+
 	// GetPublishedCounter returns the metric.
 	GetPublishedCounter() *expvar.Int
 
 	// GetPublishedFailedCounter returns the metric.
 	GetPublishedFailedCounter() *expvar.Int
 
+	// GetRetriedCounter returns the metric.
+	GetRetriedCounter() *expvar.Int
+
+	// GetRetryExhaustedCounter returns the metric.
+	GetRetryExhaustedCounter() *expvar.Int
+
+	// GetRetrySucceededCounter returns the metric.
+	GetRetrySucceededCounter() *expvar.Int
+
+	// GetSignatureUnverifiedCounter returns the metric.
+	GetSignatureUnverifiedCounter() *expvar.Int
+
 	// GetSubscribedCounter returns the metric.
 	GetSubscribedCounter() *expvar.Int
 
 	// GetSubscribedFailedCounter returns the metric.
 	GetSubscribedFailedCounter() *expvar.Int
+
+	// GetTerminatedCounter returns the metric.
+	GetTerminatedCounter() *expvar.Int
 }
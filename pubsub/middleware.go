@@ -0,0 +1,53 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// PublishHandler publishes a message, returning the published message, or
+// the reply, if synchronous.
+type PublishHandler func(ctx context.Context, msg *message.Message, o *Options) (*message.Message, error)
+
+// PublishMiddleware wraps the publishing of each message, e.g.: to authorize,
+// enrich, or redact messages, or to measure publishes. It calls `next` to
+// continue.
+type PublishMiddleware func(next PublishHandler) PublishHandler
+
+//////
+// Helpers.
+//////
+
+// chain wraps `h` with the pubsub, then the subscription handler middlewares,
+// the first being the outermost.
+func (p *PubSub) chain(s *subscription.Subscription, h subscription.HandlerFunc) subscription.HandlerFunc {
+	for i := len(s.Middlewares) - 1; i >= 0; i-- {
+		h = s.Middlewares[i](h)
+	}
+
+	for i := len(p.HandlerMiddlewares) - 1; i >= 0; i-- {
+		h = p.HandlerMiddlewares[i](h)
+	}
+
+	return h
+}
+
+//////
+// Methods.
+//////
+
+// Publishing wraps `publish`, the pubsub implementation publishing of a
+// message, with the publish middlewares, the first being the outermost.
+func (p *PubSub) Publishing(publish PublishHandler) PublishHandler {
+	for i := len(p.PublishMiddlewares) - 1; i >= 0; i-- {
+		publish = p.PublishMiddlewares[i](publish)
+	}
+
+	return publish
+}
@@ -57,17 +57,74 @@ type Mock struct {
 	// GetCounterPingFailed returns the metric.
 	MockGetCounterPingFailed func() *expvar.Int
 
+	// GetAckedCounter returns the metric.
+	MockGetAckedCounter func() *expvar.Int
+
+	// GetBreakerRejectedCounter returns the metric.
+	MockGetBreakerRejectedCounter func() *expvar.Int
+
+	// GetBreakerStateGauge returns the metric.
+	MockGetBreakerStateGauge func() *expvar.Int
+
+	// GetChannelDroppedCounter returns the metric.
+	MockGetChannelDroppedCounter func() *expvar.Int
+
+	// GetDeadLetteredCounter returns the metric.
+	MockGetDeadLetteredCounter func() *expvar.Int
+
+	// GetDecodeDroppedCounter returns the metric.
+	MockGetDecodeDroppedCounter func() *expvar.Int
+
+	// GetDecodeHookedCounter returns the metric.
+	MockGetDecodeHookedCounter func() *expvar.Int
+
+	// GetDecodePoisonedCounter returns the metric.
+	MockGetDecodePoisonedCounter func() *expvar.Int
+
+	// GetDeduplicatedCounter returns the metric.
+	MockGetDeduplicatedCounter func() *expvar.Int
+
+	// GetHandlerPanickedCounter returns the metric.
+	MockGetHandlerPanickedCounter func() *expvar.Int
+
+	// GetInProgressCounter returns the metric.
+	MockGetInProgressCounter func() *expvar.Int
+
+	// GetNackedCounter returns the metric.
+	MockGetNackedCounter func() *expvar.Int
+
+	// GetPlaintextRejectedCounter returns the metric.
+	MockGetPlaintextRejectedCounter func() *expvar.Int
+
+	// GetPublishRetriedCounter returns the metric.
+	MockGetPublishRetriedCounter func() *expvar.Int
+
 	// GetPublishedCounter returns the metric.
 	MockGetPublishedCounter func() *expvar.Int
 
 	// GetPublishedFailedCounter returns the metric.
 	MockGetPublishedFailedCounter func() *expvar.Int
 
+	// GetRetriedCounter returns the metric.
+	MockGetRetriedCounter func() *expvar.Int
+
+	// GetRetryExhaustedCounter returns the metric.
+	MockGetRetryExhaustedCounter func() *expvar.Int
+
+	// GetRetrySucceededCounter returns the metric.
+	MockGetRetrySucceededCounter func() *expvar.Int
+
+	// GetSignatureUnverifiedCounter returns the metric.
+	MockGetSignatureUnverifiedCounter func() *expvar.Int
+
 	// GetSubscribedCounter returns the metric.
 	MockGetSubscribedCounter func() *expvar.Int
 
 	// GetSubscribedFailedCounter returns the metric.
 	MockGetSubscribedFailedCounter func() *expvar.Int
+
+	// GetTerminatedCounter returns the metric.
+	MockGetTerminatedCounter func() *expvar.Int
 }
 
 //////
@@ -141,6 +198,76 @@ func (m *Mock) GetCounterPingFailed() *expvar.Int {
 	return m.MockGetCounterPingFailed()
 }
 
+// GetAckedCounter returns the metric.
+func (m *Mock) GetAckedCounter() *expvar.Int {
+	return m.MockGetAckedCounter()
+}
+
+// GetBreakerRejectedCounter returns the metric.
+func (m *Mock) GetBreakerRejectedCounter() *expvar.Int {
+	return m.MockGetBreakerRejectedCounter()
+}
+
+// GetBreakerStateGauge returns the metric.
+func (m *Mock) GetBreakerStateGauge() *expvar.Int {
+	return m.MockGetBreakerStateGauge()
+}
+
+// GetChannelDroppedCounter returns the metric.
+func (m *Mock) GetChannelDroppedCounter() *expvar.Int {
+	return m.MockGetChannelDroppedCounter()
+}
+
+// GetDeadLetteredCounter returns the metric.
+func (m *Mock) GetDeadLetteredCounter() *expvar.Int {
+	return m.MockGetDeadLetteredCounter()
+}
+
+// GetDecodeDroppedCounter returns the metric.
+func (m *Mock) GetDecodeDroppedCounter() *expvar.Int {
+	return m.MockGetDecodeDroppedCounter()
+}
+
+// GetDecodeHookedCounter returns the metric.
+func (m *Mock) GetDecodeHookedCounter() *expvar.Int {
+	return m.MockGetDecodeHookedCounter()
+}
+
+// GetDecodePoisonedCounter returns the metric.
+func (m *Mock) GetDecodePoisonedCounter() *expvar.Int {
+	return m.MockGetDecodePoisonedCounter()
+}
+
+// GetDeduplicatedCounter returns the metric.
+func (m *Mock) GetDeduplicatedCounter() *expvar.Int {
+	return m.MockGetDeduplicatedCounter()
+}
+
+// GetHandlerPanickedCounter returns the metric.
+func (m *Mock) GetHandlerPanickedCounter() *expvar.Int {
+	return m.MockGetHandlerPanickedCounter()
+}
+
+// GetInProgressCounter returns the metric.
+func (m *Mock) GetInProgressCounter() *expvar.Int {
+	return m.MockGetInProgressCounter()
+}
+
+// GetNackedCounter returns the metric.
+func (m *Mock) GetNackedCounter() *expvar.Int {
+	return m.MockGetNackedCounter()
+}
+
+// GetPlaintextRejectedCounter returns the metric.
+func (m *Mock) GetPlaintextRejectedCounter() *expvar.Int {
+	return m.MockGetPlaintextRejectedCounter()
+}
+
+// GetPublishRetriedCounter returns the metric.
+func (m *Mock) GetPublishRetriedCounter() *expvar.Int {
+	return m.MockGetPublishRetriedCounter()
+}
+
 // GetPublishedCounter returns the metric.
 func (m *Mock) GetPublishedCounter() *expvar.Int {
 	return m.MockGetPublishedCounter()
@@ -151,6 +278,26 @@ func (m *Mock) GetPublishedFailedCounter() *expvar.Int {
 	return m.MockGetPublishedFailedCounter()
 }
 
+// GetRetriedCounter returns the metric.
+func (m *Mock) GetRetriedCounter() *expvar.Int {
+	return m.MockGetRetriedCounter()
+}
+
+// GetRetryExhaustedCounter returns the metric.
+func (m *Mock) GetRetryExhaustedCounter() *expvar.Int {
+	return m.MockGetRetryExhaustedCounter()
+}
+
+// GetRetrySucceededCounter returns the metric.
+func (m *Mock) GetRetrySucceededCounter() *expvar.Int {
+	return m.MockGetRetrySucceededCounter()
+}
+
+// GetSignatureUnverifiedCounter returns the metric.
+func (m *Mock) GetSignatureUnverifiedCounter() *expvar.Int {
+	return m.MockGetSignatureUnverifiedCounter()
+}
+
 // GetSubscribedCounter returns the metric.
 func (m *Mock) GetSubscribedCounter() *expvar.Int {
 	return m.MockGetSubscribedCounter()
@@ -160,3 +307,8 @@ func (m *Mock) GetSubscribedCounter() *expvar.Int {
 func (m *Mock) GetSubscribedFailedCounter() *expvar.Int {
 	return m.MockGetSubscribedFailedCounter()
 }
+
+// GetTerminatedCounter returns the metric.
+func (m *Mock) GetTerminatedCounter() *expvar.Int {
+	return m.MockGetTerminatedCounter()
+}
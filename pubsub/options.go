@@ -1,6 +1,8 @@
 package pubsub
 
 import (
+	"github.com/WreckingBallStudioLabs/pubsub/codec"
+	"github.com/WreckingBallStudioLabs/pubsub/compression"
 	"github.com/thalesfsp/validation"
 )
 
@@ -13,7 +15,25 @@ type Func func(o *Options) error
 
 // Options for operations.
 type Options struct {
-	// If the operation is synchronous.
+	// Codec encodes the published messages. Defaults to the pubsub one.
+	Codec codec.Codec `json:"-"`
+
+	// Compressor compresses the published messages payloads, from
+	// `CompressionThreshold` bytes. Defaults to the pubsub one.
+	Compressor compression.Compressor `json:"-"`
+
+	// CompressionThreshold is the payload size, in bytes, from which payloads
+	// are compressed. Only used with `Compressor`.
+	CompressionThreshold int `json:"compressionThreshold" validate:"gte=0"`
+
+	// ContentID derives the published messages IDs from their content, see
+	// `WithContentID`.
+	ContentID bool `json:"contentID"`
+
+	// If the operation is synchronous. Publishing synchronously means a
+	// request: it waits, bounded by the context deadline, for a subscriber to
+	// reply (see `message.Respond`). Subscribing synchronously means messages
+	// aren't pushed, but pulled (see `subscription.Next`).
 	Sync bool `json:"sync" default:"false" env:"PUBSUB_SYNC"`
 }
 
@@ -21,7 +41,43 @@ type Options struct {
 // Exported built-in options.
 //////
 
-// WithSync set the sync option.
+// WithCodec sets the codec used to encode the published messages, overriding
+// the pubsub one. Consumers decode them automatically.
+func WithCodec(c codec.Codec) Func {
+	return func(o *Options) error {
+		o.Codec = c
+
+		return nil
+	}
+}
+
+// WithCompression compresses the published messages payloads with `c`, from
+// `threshold` bytes, overriding the pubsub compression. Consumers decompress
+// them automatically.
+func WithCompression(c compression.Compressor, threshold int) Func {
+	return func(o *Options) error {
+		o.Compressor = c
+		o.CompressionThreshold = threshold
+
+		return nil
+	}
+}
+
+// WithContentID derives the published messages IDs from their topic, and
+// data, see `message.Message.ContentID`, instead of random ones, so retries of
+// the same logical event have the same ID, and can be deduplicated, by
+// consumers (see `dedup.ByID`), or by the broker, e.g.: JetStream.
+func WithContentID() Func {
+	return func(o *Options) error {
+		o.ContentID = true
+
+		return nil
+	}
+}
+
+// WithSync set the sync option. When publishing, the replies are returned
+// instead of the published messages. When subscribing, `subscription.Func`, and
+// `subscription.Channel` aren't used.
 func WithSync(sync bool) Func {
 	return func(o *Options) error {
 		o.Sync = sync
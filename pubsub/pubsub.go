@@ -4,10 +4,16 @@ import (
 	"context"
 	"expvar"
 	"fmt"
+	"time"
 
+	"github.com/WreckingBallStudioLabs/pubsub/codec"
+	"github.com/WreckingBallStudioLabs/pubsub/compression"
+	"github.com/WreckingBallStudioLabs/pubsub/encryption"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/customapm"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
 	"github.com/WreckingBallStudioLabs/pubsub/internal/metrics"
+	"github.com/WreckingBallStudioLabs/pubsub/signing"
+	"github.com/WreckingBallStudioLabs/pubsub/subscription"
 	"github.com/thalesfsp/status"
 	"github.com/thalesfsp/sypl"
 	"github.com/thalesfsp/sypl/level"
@@ -22,6 +28,7 @@ import (
 // example, to identify the entity in the logs, metrics, and for tracing.
 const (
 	DefaultMetricCounterLabel = "counter"
+	DefaultMetricGaugeLabel   = "gauge"
 	Type                      = "pubsub"
 
 	// Operation name.
@@ -29,21 +36,91 @@ const (
 	OperationSubscribe = "subscribe"
 )
 
+// DefaultRedeliveryDelay is the default wait before a message which handling
+// failed is redelivered, by pubsubs supporting it.
+const DefaultRedeliveryDelay = time.Second
+
 // PubSub definition.
 type PubSub struct {
+	// Codec encodes the published messages, unless overridden per publish,
+	// see `WithCodec`. Defaults to `codec.Default`.
+	Codec codec.Codec `json:"-"`
+
+	// Compressor compresses the published messages payloads, unless overridden
+	// per publish, see `WithCompression`. Compression is off if not set.
+	Compressor compression.Compressor `json:"-"`
+
+	// CompressionThreshold is the payload size, in bytes, from which payloads
+	// are compressed. Defaults to `compression.DefaultThreshold`.
+	CompressionThreshold int `json:"compressionThreshold" validate:"gte=0"`
+
+	// Encryptor encrypts the published messages, per topic pattern, and
+	// decrypts the received ones. Encryption is off if not set.
+	Encryptor *encryption.Encryptor `json:"-"`
+
+	// HandlerMiddlewares wrap the handling of messages received by all
+	// subscriptions, before the subscription ones.
+	HandlerMiddlewares []subscription.HandlerMiddleware `json:"-"`
+
 	// Logger.
 	Logger sypl.ISypl `json:"-" validate:"required"`
 
+	// MaxDecompressedSize is the maximum size, in bytes, received payloads
+	// decompress to, otherwise they fail to decode. Defaults to
+	// `compression.DefaultMaxSize`, 0 disables the limit.
+	MaxDecompressedSize int `json:"maxDecompressedSize" validate:"gte=0"`
+
 	// Name of the pubsub type.
 	Name string `json:"name" validate:"required,lowercase,gte=1"`
 
+	// PublishMiddlewares wrap the publishing of each message, the first being
+	// the outermost.
+	PublishMiddlewares []PublishMiddleware `json:"-"`
+
+	// RedeliveryDelay is the wait before a message which handling failed is
+	// redelivered, by pubsubs supporting it, unless the subscription has a
+	// retry policy, then its backoff for the attempt is used. Defaults to
+	// `DefaultRedeliveryDelay`.
+	RedeliveryDelay time.Duration `json:"redeliveryDelay" validate:"gte=0"`
+
+	// Resilience retries failed publishes, and fast-fails them, through a
+	// circuit breaker, while the broker is unhealthy. Off if not set.
+	Resilience *Resilience `json:"-"`
+
+	// Sender sends envelopes, as is, to a topic. It's set by the pubsub
+	// implementations, and used to route messages, e.g.: to poison topics.
+	Sender SendFunc `json:"-"`
+
+	// Signer signs the published messages, per topic pattern, and verifies
+	// the received ones against the trusted keys. Signing is off if not set.
+	Signer *signing.Signer `json:"-"`
+
 	// Metrics.
+	counterAcked               *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterBreakerRejected     *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterChannelDropped      *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterDeadLettered        *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterDecodeDropped       *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterDecodeHooked        *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterDecodePoisoned      *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterDeduplicated        *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterHandlerPanicked     *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterInProgress          *expvar.Int `json:"-" validate:"required,gte=0"`
 	counterInstantiationFailed *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterNacked              *expvar.Int `json:"-" validate:"required,gte=0"`
 	counterPingFailed          *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterPlaintextRejected   *expvar.Int `json:"-" validate:"required,gte=0"`
 	counterPublished           *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterPublishRetried      *expvar.Int `json:"-" validate:"required,gte=0"`
 	counterPublishedFailed     *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterRetried             *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterRetryExhausted      *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterRetrySucceeded      *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterSignatureUnverified *expvar.Int `json:"-" validate:"required,gte=0"`
 	counterSubscribed          *expvar.Int `json:"-" validate:"required,gte=0"`
 	counterSubscribedFailed    *expvar.Int `json:"-" validate:"required,gte=0"`
+	counterTerminated          *expvar.Int `json:"-" validate:"required,gte=0"`
+	gaugeBreakerState          *expvar.Int `json:"-" validate:"required,gte=0"`
 }
 
 //////
@@ -70,6 +147,77 @@ func (p *PubSub) GetCounterPingFailed() *expvar.Int {
 	return p.counterPingFailed
 }
 
+// GetAckedCounter returns the metric.
+func (p *PubSub) GetAckedCounter() *expvar.Int {
+	return p.counterAcked
+}
+
+// GetBreakerRejectedCounter returns the metric.
+func (p *PubSub) GetBreakerRejectedCounter() *expvar.Int {
+	return p.counterBreakerRejected
+}
+
+// GetBreakerStateGauge returns the metric: the circuit breaker state, 0 if
+// closed, 1 if open, 2 if half-open.
+func (p *PubSub) GetBreakerStateGauge() *expvar.Int {
+	return p.gaugeBreakerState
+}
+
+// GetChannelDroppedCounter returns the metric.
+func (p *PubSub) GetChannelDroppedCounter() *expvar.Int {
+	return p.counterChannelDropped
+}
+
+// GetDeadLetteredCounter returns the metric.
+func (p *PubSub) GetDeadLetteredCounter() *expvar.Int {
+	return p.counterDeadLettered
+}
+
+// GetDecodeDroppedCounter returns the metric.
+func (p *PubSub) GetDecodeDroppedCounter() *expvar.Int {
+	return p.counterDecodeDropped
+}
+
+// GetDecodeHookedCounter returns the metric.
+func (p *PubSub) GetDecodeHookedCounter() *expvar.Int {
+	return p.counterDecodeHooked
+}
+
+// GetDecodePoisonedCounter returns the metric.
+func (p *PubSub) GetDecodePoisonedCounter() *expvar.Int {
+	return p.counterDecodePoisoned
+}
+
+// GetDeduplicatedCounter returns the metric.
+func (p *PubSub) GetDeduplicatedCounter() *expvar.Int {
+	return p.counterDeduplicated
+}
+
+// GetHandlerPanickedCounter returns the metric.
+func (p *PubSub) GetHandlerPanickedCounter() *expvar.Int {
+	return p.counterHandlerPanicked
+}
+
+// GetInProgressCounter returns the metric.
+func (p *PubSub) GetInProgressCounter() *expvar.Int {
+	return p.counterInProgress
+}
+
+// GetNackedCounter returns the metric.
+func (p *PubSub) GetNackedCounter() *expvar.Int {
+	return p.counterNacked
+}
+
+// GetPlaintextRejectedCounter returns the metric.
+func (p *PubSub) GetPlaintextRejectedCounter() *expvar.Int {
+	return p.counterPlaintextRejected
+}
+
+// GetPublishRetriedCounter returns the metric.
+func (p *PubSub) GetPublishRetriedCounter() *expvar.Int {
+	return p.counterPublishRetried
+}
+
 // GetPublishedCounter returns the metric.
 func (p *PubSub) GetPublishedCounter() *expvar.Int {
 	return p.counterPublished
@@ -80,6 +228,26 @@ func (p *PubSub) GetPublishedFailedCounter() *expvar.Int {
 	return p.counterPublishedFailed
 }
 
+// GetRetriedCounter returns the metric.
+func (p *PubSub) GetRetriedCounter() *expvar.Int {
+	return p.counterRetried
+}
+
+// GetRetryExhaustedCounter returns the metric.
+func (p *PubSub) GetRetryExhaustedCounter() *expvar.Int {
+	return p.counterRetryExhausted
+}
+
+// GetRetrySucceededCounter returns the metric.
+func (p *PubSub) GetRetrySucceededCounter() *expvar.Int {
+	return p.counterRetrySucceeded
+}
+
+// GetSignatureUnverifiedCounter returns the metric.
+func (p *PubSub) GetSignatureUnverifiedCounter() *expvar.Int {
+	return p.counterSignatureUnverified
+}
+
 // GetSubscribedCounter returns the metric.
 func (p *PubSub) GetSubscribedCounter() *expvar.Int {
 	return p.counterSubscribed
@@ -90,6 +258,11 @@ func (p *PubSub) GetSubscribedFailedCounter() *expvar.Int {
 	return p.counterSubscribedFailed
 }
 
+// GetTerminatedCounter returns the metric.
+func (p *PubSub) GetTerminatedCounter() *expvar.Int {
+	return p.counterTerminated
+}
+
 //////
 // Factory.
 //////
@@ -100,15 +273,38 @@ func New(ctx context.Context, name string) (*PubSub, error) {
 	logger := logging.Get().New(name).SetTags(Type, name)
 
 	a := &PubSub{
-		Logger: logger,
-		Name:   name,
+		Codec:                codec.Default,
+		CompressionThreshold: compression.DefaultThreshold,
+		Logger:               logger,
+		MaxDecompressedSize:  compression.DefaultMaxSize,
+		Name:                 name,
+		RedeliveryDelay:      DefaultRedeliveryDelay,
 
+		counterAcked:               metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "ack.acked", DefaultMetricCounterLabel)),
+		counterBreakerRejected:     metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "publish.breaker.rejected", DefaultMetricCounterLabel)),
+		counterChannelDropped:      metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "channel.dropped", DefaultMetricCounterLabel)),
+		counterDeadLettered:        metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "deadlettered", DefaultMetricCounterLabel)),
+		counterDecodeDropped:       metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "decode.dropped", DefaultMetricCounterLabel)),
+		counterDecodeHooked:        metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "decode.hooked", DefaultMetricCounterLabel)),
+		counterDecodePoisoned:      metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "decode.poisoned", DefaultMetricCounterLabel)),
+		counterDeduplicated:        metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "dedup.skipped", DefaultMetricCounterLabel)),
+		counterHandlerPanicked:     metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "handler.panicked", DefaultMetricCounterLabel)),
+		counterInProgress:          metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "ack.inprogress", DefaultMetricCounterLabel)),
 		counterInstantiationFailed: metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "instantiation."+status.Failed, DefaultMetricCounterLabel)),
+		counterNacked:              metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "ack.nacked", DefaultMetricCounterLabel)),
 		counterPingFailed:          metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "ping."+status.Failed, DefaultMetricCounterLabel)),
+		counterPlaintextRejected:   metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "encryption.plaintext.rejected", DefaultMetricCounterLabel)),
 		counterPublished:           metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, status.Published, DefaultMetricCounterLabel)),
+		counterPublishRetried:      metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "publish.retried", DefaultMetricCounterLabel)),
 		counterPublishedFailed:     metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, status.Published+"."+status.Failed, DefaultMetricCounterLabel)),
+		counterRetried:             metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "handler.retried", DefaultMetricCounterLabel)),
+		counterRetryExhausted:      metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "handler.retry.exhausted", DefaultMetricCounterLabel)),
+		counterRetrySucceeded:      metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "handler.retry.succeeded", DefaultMetricCounterLabel)),
+		counterSignatureUnverified: metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "signature.unverified", DefaultMetricCounterLabel)),
 		counterSubscribed:          metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, status.Subscribed, DefaultMetricCounterLabel)),
 		counterSubscribedFailed:    metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, status.Subscribed+"."+status.Failed, DefaultMetricCounterLabel)),
+		counterTerminated:          metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "ack.terminated", DefaultMetricCounterLabel)),
+		gaugeBreakerState:          metrics.NewInt(fmt.Sprintf("%s.%s.%s.%s", Type, name, "publish.breaker.state", DefaultMetricGaugeLabel)),
 	}
 
 	// Validate the pubsub.
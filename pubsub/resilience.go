@@ -0,0 +1,232 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/logging"
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/thalesfsp/customerror"
+	"github.com/thalesfsp/sypl"
+	"github.com/thalesfsp/sypl/fields"
+	"github.com/thalesfsp/sypl/level"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// classifier classifies errors for the retrier: transient ones are retried.
+type classifier func(err error) bool
+
+// Classify implements the `retrier.Classifier` interface.
+func (c classifier) Classify(err error) retrier.Action {
+	switch {
+	case err == nil:
+		return retrier.Succeed
+	case c(err):
+		return retrier.Retry
+	default:
+		return retrier.Fail
+	}
+}
+
+// Resilience retries publishes failing with transient errors, and fast-fails
+// them, through a circuit breaker, while the broker is unhealthy. It wraps the
+// backend client calls, see `PubSub.Protect`.
+type Resilience struct {
+	mu        sync.Mutex
+	breaker   *breaker.Breaker
+	retry     *backoff.Policy
+	state     breaker.State
+	timeout   time.Duration
+	transient func(err error) bool
+}
+
+//////
+// Exported functionalities.
+//////
+
+// IsTransient is the default transient errors classification: all errors, but
+// context ones, and the circuit breaker being open.
+func IsTransient(err error) bool {
+	return err != nil &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, breaker.ErrBreakerOpen)
+}
+
+//////
+// Methods.
+//////
+
+// WithRetry retries publishes failing with transient errors following
+// `policy`, e.g.: `backoff.Exponential(3, 100*time.Millisecond)`.
+func (r *Resilience) WithRetry(policy *backoff.Policy) *Resilience {
+	r.retry = policy
+
+	return r
+}
+
+// WithBreaker opens the circuit breaker after `errorThreshold` transient
+// failures, without a `timeout` long error-free period. While open, publishes
+// fast-fail, wrapping `breaker.ErrBreakerOpen`. After `timeout`, it's
+// half-open, and closes after `successThreshold` consecutive successes, or
+// opens again on a single failure.
+func (r *Resilience) WithBreaker(errorThreshold, successThreshold int, timeout time.Duration) *Resilience {
+	r.breaker = breaker.New(errorThreshold, successThreshold, timeout)
+	r.timeout = timeout
+
+	return r
+}
+
+// WithTransient sets how errors are classified: transient ones are retried, and
+// count for the circuit breaker. Defaults to `IsTransient`.
+func (r *Resilience) WithTransient(fn func(err error) bool) *Resilience {
+	r.transient = fn
+
+	return r
+}
+
+// call runs `fn` through the circuit breaker, if set.
+func (r *Resilience) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.breaker == nil {
+		return fn(ctx)
+	}
+
+	var err error
+
+	if bErr := r.breaker.Run(func() error {
+		err = fn(ctx)
+
+		// Only transient failures tell the broker is unhealthy.
+		if err != nil && !r.transient(err) {
+			return nil
+		}
+
+		return err
+	}); errors.Is(bErr, breaker.ErrBreakerOpen) {
+		return bErr
+	}
+
+	return err
+}
+
+// watch observes the open circuit breaker until it becomes half-open, after
+// the timeout.
+func (p *PubSub) watch(r *Resilience, after time.Duration) {
+	time.AfterFunc(after, func() {
+		if !p.observe(r) {
+			p.watch(r, r.timeout/10+time.Millisecond)
+		}
+	})
+}
+
+// observe records the circuit breaker state, if changed, logging it. Once
+// open, it's watched until it becomes half-open. It returns if changed.
+func (p *PubSub) observe(r *Resilience) bool {
+	if r.breaker == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := r.breaker.GetState()
+	if state == r.state {
+		return false
+	}
+
+	r.state = state
+
+	p.gaugeBreakerState.Set(int64(state))
+
+	var name string
+
+	switch state {
+	case breaker.Closed:
+		name = "closed"
+	case breaker.Open:
+		name = "open"
+
+		p.watch(r, r.timeout)
+	case breaker.HalfOpen:
+		name = "half-open"
+	}
+
+	p.GetLogger().PrintlnWithOptions(
+		level.Warn,
+		"circuit breaker "+name,
+		sypl.WithFields(fields.Fields{"state": name}),
+	)
+
+	return true
+}
+
+// Protect runs `fn`, a backend client call publishing, through the
+// resilience layer, if set, see `Resilience`. It returns the last failure.
+func (p *PubSub) Protect(ctx context.Context, fn func(ctx context.Context) error) error {
+	r := p.Resilience
+	if r == nil {
+		return fn(ctx)
+	}
+
+	var (
+		attempts int
+		backoff  []time.Duration
+		jitter   float64
+	)
+
+	if r.retry != nil {
+		backoff, jitter = r.retry.Backoff, r.retry.Jitter
+	}
+
+	rt := retrier.New(backoff, classifier(r.transient)).WithSurfaceWorkErrors()
+	rt.SetJitter(jitter)
+
+	err := rt.RunCtx(ctx, func(ctx context.Context) error {
+		attempts++
+
+		if attempts > 1 {
+			p.counterPublishRetried.Add(1)
+
+			p.GetLogger().PrintlnWithOptions(
+				level.Warn,
+				"retrying publish",
+				sypl.WithFields(logging.ToAPM(ctx, fields.Fields{"attempt": attempts})),
+			)
+		}
+
+		err := r.call(ctx, fn)
+
+		p.observe(r)
+
+		return err
+	})
+
+	if errors.Is(err, breaker.ErrBreakerOpen) {
+		p.counterBreakerRejected.Add(1)
+
+		return errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrBreakerOpen).
+			NewFailedToError(customerror.WithError(err))
+	}
+
+	return err
+}
+
+//////
+// Factory.
+//////
+
+// NewResilience creates a resilience layer, which neither retries, nor has a
+// circuit breaker, until set, see `WithRetry`, and `WithBreaker`.
+func NewResilience() *Resilience {
+	return &Resilience{transient: IsTransient}
+}
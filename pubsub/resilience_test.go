@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
+	"github.com/WreckingBallStudioLabs/pubsub/internal/shared"
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_Protect(t *testing.T) {
+	t.Setenv("PUBSUB_METRICS_PREFIX", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.DefaultTimeout)
+	defer cancel()
+
+	errUnavailable := errors.New("unavailable")
+
+	t.Run("Should work - off", func(t *testing.T) {
+		p, err := New(ctx, "protect")
+		assert.NoError(t, err)
+
+		calls := 0
+
+		assert.ErrorIs(t, p.Protect(ctx, func(context.Context) error {
+			calls++
+
+			return errUnavailable
+		}), errUnavailable)
+
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Should work - retry", func(t *testing.T) {
+		p, err := New(ctx, "protect")
+		assert.NoError(t, err)
+
+		p.Resilience = NewResilience().WithRetry(backoff.Constant(3, time.Millisecond))
+
+		calls := 0
+
+		// Succeeds on the third call.
+		assert.NoError(t, p.Protect(ctx, func(context.Context) error {
+			calls++
+
+			if calls < 3 {
+				return errUnavailable
+			}
+
+			return nil
+		}))
+
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, int64(2), p.GetPublishRetriedCounter().Value())
+
+		// Not transient, not retried.
+		calls = 0
+
+		p.Resilience.WithTransient(func(err error) bool { return false })
+
+		assert.ErrorIs(t, p.Protect(ctx, func(context.Context) error {
+			calls++
+
+			return errUnavailable
+		}), errUnavailable)
+
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Should work - breaker", func(t *testing.T) {
+		p, err := New(ctx, "protect")
+		assert.NoError(t, err)
+
+		p.Resilience = NewResilience().WithBreaker(2, 1, 50*time.Millisecond)
+
+		calls := 0
+
+		failing := func(context.Context) error {
+			calls++
+
+			return errUnavailable
+		}
+
+		assert.ErrorIs(t, p.Protect(ctx, failing), errUnavailable)
+		assert.ErrorIs(t, p.Protect(ctx, failing), errUnavailable)
+		assert.Equal(t, int64(breaker.Open), p.GetBreakerStateGauge().Value())
+
+		// Fast-fails while open.
+		assert.ErrorIs(t, p.Protect(ctx, failing), breaker.ErrBreakerOpen)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, int64(1), p.GetBreakerRejectedCounter().Value())
+
+		// Half-open after the timeout, closed on success.
+		assert.Eventually(t, func() bool {
+			return p.GetBreakerStateGauge().Value() == int64(breaker.HalfOpen)
+		}, shared.DefaultTimeout, 10*time.Millisecond)
+
+		assert.NoError(t, p.Protect(ctx, func(context.Context) error { return nil }))
+		assert.Equal(t, int64(breaker.Closed), p.GetBreakerStateGauge().Value())
+	})
+}
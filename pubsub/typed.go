@@ -0,0 +1,32 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+)
+
+//////
+// Exported functionalities.
+//////
+
+// PublishTyped publishes `data` to `topic` with `ps`. It returns the published
+// message, or the reply if published synchronously, see `WithSync`. Consumers
+// get `data` back decoded with `subscription.NewTyped`.
+func PublishTyped[T any](ctx context.Context, ps IPubSub, topic string, data T, opts ...Func) (*message.Message, error) {
+	msg, err := message.New(topic, data)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, errs := ps.Publish(ctx, []*message.Message{msg}, opts...)
+	if errs != nil {
+		return nil, errs
+	}
+
+	if len(msgs) == 0 {
+		return msg, nil
+	}
+
+	return msgs[0], nil
+}
@@ -0,0 +1,3 @@
+// Package signing provides signing of messages, per topic pattern, with HMAC,
+// or Ed25519 keys, and their verification against trusted keys.
+package signing
@@ -0,0 +1,138 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Key signs, and verifies messages.
+type Key interface {
+	// ID returns the key ID, recorded in the `KeyIDHeader` header.
+	ID() string
+
+	// Sign signs `data`.
+	Sign(data []byte) ([]byte, error)
+
+	// Verify returns true if `signature` is a valid signature of `data`.
+	Verify(data, signature []byte) bool
+}
+
+// HMAC is a HMAC-SHA256 key, a secret shared by publishers, and subscribers.
+type HMAC struct {
+	id     string
+	secret []byte
+}
+
+// Ed25519 is an Ed25519 key. Publishers sign with the private key,
+// subscribers only need the public key.
+type Ed25519 struct {
+	id         string
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+//////
+// Helpers.
+//////
+
+// invalidKeyError returns the error used when a key is invalid.
+func invalidKeyError(id string) error {
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrSigningInvalidKey).
+		NewFailedToError(customerror.WithField("keyID", id))
+}
+
+//////
+// Implements the Key interface.
+//////
+
+// ID returns the key ID.
+func (k *HMAC) ID() string {
+	return k.id
+}
+
+// Sign signs `data`.
+func (k *HMAC) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+
+	// Never fails.
+	_, _ = mac.Write(data)
+
+	return mac.Sum(nil), nil
+}
+
+// Verify returns true if `signature` is a valid signature of `data`.
+func (k *HMAC) Verify(data, signature []byte) bool {
+	expected, _ := k.Sign(data)
+
+	return hmac.Equal(expected, signature)
+}
+
+// ID returns the key ID.
+func (k *Ed25519) ID() string {
+	return k.id
+}
+
+// Sign signs `data`. It fails for keys only having the public key.
+func (k *Ed25519) Sign(data []byte) ([]byte, error) {
+	if k.privateKey == nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSigningSign).
+			NewFailedToError(
+				customerror.WithField("keyID", k.id),
+				customerror.WithField("reason", "no private key"),
+			)
+	}
+
+	return ed25519.Sign(k.privateKey, data), nil
+}
+
+// Verify returns true if `signature` is a valid signature of `data`.
+func (k *Ed25519) Verify(data, signature []byte) bool {
+	return ed25519.Verify(k.publicKey, data, signature)
+}
+
+//////
+// Factory.
+//////
+
+// NewHMAC creates a HMAC-SHA256 key. `secret` should be at least 32 bytes
+// long.
+func NewHMAC(id string, secret []byte) (*HMAC, error) {
+	if id == "" || len(secret) < sha256.Size {
+		return nil, invalidKeyError(id)
+	}
+
+	return &HMAC{id: id, secret: secret}, nil
+}
+
+// NewEd25519 creates an Ed25519 key, to sign, and verify with.
+func NewEd25519(id string, privateKey ed25519.PrivateKey) (*Ed25519, error) {
+	if id == "" || len(privateKey) != ed25519.PrivateKeySize {
+		return nil, invalidKeyError(id)
+	}
+
+	publicKey, _ := privateKey.Public().(ed25519.PublicKey)
+
+	return &Ed25519{id: id, privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// NewEd25519Public creates an Ed25519 key, to verify with only, e.g.: the
+// publisher's key trusted by subscribers.
+func NewEd25519Public(id string, publicKey ed25519.PublicKey) (*Ed25519, error) {
+	if id == "" || len(publicKey) != ed25519.PublicKeySize {
+		return nil, invalidKeyError(id)
+	}
+
+	return &Ed25519{id: id, publicKey: publicKey}, nil
+}
@@ -0,0 +1,221 @@
+package signing
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
+	"github.com/WreckingBallStudioLabs/pubsub/name"
+	"github.com/thalesfsp/customerror"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Headers recording the signature of a message.
+const (
+	// KeyIDHeader is the ID of the key used to sign the message.
+	KeyIDHeader = "Signature-Key-Id"
+
+	// SignatureHeader is the base64 encoded signature.
+	SignatureHeader = "Signature"
+)
+
+// DefaultQuarantineTopicSuffix is appended to the topic to name the quarantine
+// topic, e.g.: "v1.billing.charged.quarantine".
+const DefaultQuarantineTopicSuffix = ".quarantine"
+
+// Policy is what to do with messages which can't be verified.
+type Policy string
+
+// Verification policies.
+const (
+	// PolicyCount counts, and delivers the message.
+	PolicyCount Policy = "count"
+
+	// PolicyQuarantine counts, and routes the message, as is, to the
+	// subscription topic suffixed with `DefaultQuarantineTopicSuffix`.
+	PolicyQuarantine Policy = "quarantine"
+
+	// PolicyReject counts, and drops the message.
+	PolicyReject Policy = "reject"
+)
+
+// rule is a topic pattern, and its keys.
+type rule struct {
+	pattern string
+	keys    []Key
+}
+
+// Signer signs messages per topic pattern, and verifies received messages
+// against the keys trusted for their topics.
+type Signer struct {
+	mu      sync.RWMutex
+	policy  Policy
+	signing []rule
+	trusted []rule
+}
+
+//////
+// Helpers.
+//////
+
+// appendField appends `field` to `data`, prefixed by its length, so fields
+// can't be shifted into one another.
+func appendField(data []byte, field string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(field)))
+
+	return append(data, field...)
+}
+
+// signed returns what's signed, canonically serialized: the topic, so signed
+// messages can't be replayed on other topics, the message ID, the headers, but
+// the signature ones, sorted by key, and the payload.
+func signed(topic, id string, headers map[string]string, payload []byte) []byte {
+	keys := make([]string, 0, len(headers))
+
+	for k := range headers {
+		if k == KeyIDHeader || k == SignatureHeader {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	data := appendField(nil, topic)
+	data = appendField(data, id)
+	data = binary.AppendUvarint(data, uint64(len(keys)))
+
+	for _, k := range keys {
+		data = appendField(data, k)
+		data = appendField(data, headers[k])
+	}
+
+	return append(data, payload...)
+}
+
+// unverifiedError returns the error used when a message can't be verified.
+func unverifiedError(code, topic, id, reason string) error {
+	return errorcatalog.
+		Get().
+		MustGet(code).
+		NewFailedToError(
+			customerror.WithField("topic", topic),
+			customerror.WithField("keyID", id),
+			customerror.WithField("reason", reason),
+		)
+}
+
+//////
+// Methods.
+//////
+
+// Policy returns what to do with messages which can't be verified.
+func (s *Signer) Policy() Policy {
+	return s.policy
+}
+
+// SignWith signs messages published to topics matching `pattern` (see
+// `name.Name.Match`) with `key`. The first matching pattern wins.
+func (s *Signer) SignWith(pattern string, key Key) *Signer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signing = append(s.signing, rule{pattern: pattern, keys: []Key{key}})
+
+	return s
+}
+
+// Trust verifies messages received from topics matching `pattern` against
+// `keys`. Messages received from topics not matching any trusted pattern
+// aren't verified.
+func (s *Signer) Trust(pattern string, keys ...Key) *Signer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trusted = append(s.trusted, rule{pattern: pattern, keys: keys})
+
+	return s
+}
+
+// Sign signs the message `id`, its `headers`, but the signature ones, and
+// `payload` published to `topic`, if `topic` matches a pattern. It returns the
+// key ID, and the base64 encoded signature, empty if not signed.
+func (s *Signer) Sign(topic, id string, headers map[string]string, payload []byte) (string, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.signing {
+		if !name.Name(topic).Match(r.pattern) {
+			continue
+		}
+
+		key := r.keys[0]
+
+		signature, err := key.Sign(signed(topic, id, headers, payload))
+		if err != nil {
+			return "", "", err
+		}
+
+		return key.ID(), base64.StdEncoding.EncodeToString(signature), nil
+	}
+
+	return "", "", nil
+}
+
+// Verify verifies the message `id`, its `headers`, and `payload` received from
+// `topic` were signed by a trusted key, as recorded in the `KeyIDHeader`, and
+// `SignatureHeader` headers.
+func (s *Signer) Verify(topic, id string, headers map[string]string, payload []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keyID, signature := headers[KeyIDHeader], headers[SignatureHeader]
+
+	matched := false
+
+	for _, r := range s.trusted {
+		if !name.Name(topic).Match(r.pattern) {
+			continue
+		}
+
+		matched = true
+
+		for _, key := range r.keys {
+			if key.ID() != keyID {
+				continue
+			}
+
+			sig, err := base64.StdEncoding.DecodeString(signature)
+			if err != nil || !key.Verify(signed(topic, id, headers, payload), sig) {
+				return unverifiedError(errorcatalog.PubSubErrSigningVerify, topic, keyID, "invalid signature")
+			}
+
+			return nil
+		}
+	}
+
+	switch {
+	case !matched:
+		return nil
+	case keyID == "" || signature == "":
+		return unverifiedError(errorcatalog.PubSubErrSigningVerify, topic, keyID, "unsigned")
+	default:
+		return unverifiedError(errorcatalog.PubSubErrSigningUntrustedKey, topic, keyID, "untrusted key")
+	}
+}
+
+//////
+// Factory.
+//////
+
+// New creates a new signer, which applies `policy` to messages which can't be
+// verified.
+func New(policy Policy) *Signer {
+	return &Signer{policy: policy}
+}
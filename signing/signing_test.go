@@ -0,0 +1,109 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	payload := []byte("charged")
+
+	secret, err := NewHMAC("hmac", bytes.Repeat([]byte("s"), 32))
+	assert.NoError(t, err)
+
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	private, err := NewEd25519("billing", privateKey)
+	assert.NoError(t, err)
+
+	public, err := NewEd25519Public("billing", privateKey.Public().(ed25519.PublicKey))
+	assert.NoError(t, err)
+
+	// Invalid keys fail.
+	_, err = NewHMAC("short", []byte("s"))
+	assert.Error(t, err)
+
+	_, err = NewEd25519Public("", privateKey.Public().(ed25519.PublicKey))
+	assert.Error(t, err)
+
+	// Public keys can't sign.
+	_, err = public.Sign(payload)
+	assert.Error(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		signing Key
+		trusted Key
+	}{
+		{name: "hmac", signing: secret, trusted: secret},
+		{name: "ed25519", signing: private, trusted: public},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			publisher := New(PolicyReject).SignWith("v1.billing.>", tc.signing)
+			subscriber := New(PolicyReject).Trust("v1.billing.*", tc.trusted)
+
+			headers := map[string]string{"Content-Type": "application/json", "tenant": "acme"}
+
+			// Topics not matching any pattern aren't signed, nor verified.
+			id, signature, err := publisher.Sign("v1.meta.created", "1", headers, payload)
+			assert.NoError(t, err)
+			assert.Empty(t, id)
+			assert.Empty(t, signature)
+			assert.NoError(t, subscriber.Verify("v1.meta.created", "1", headers, payload))
+
+			id, signature, err = publisher.Sign("v1.billing.charged", "1", headers, payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.signing.ID(), id)
+
+			// withSignature returns `headers`, with `id`, and `signature`, and
+			// `extra` ones.
+			withSignature := func(id, signature string, extra ...string) map[string]string {
+				h := map[string]string{KeyIDHeader: id, SignatureHeader: signature}
+
+				for k, v := range headers {
+					h[k] = v
+				}
+
+				for i := 0; i < len(extra); i += 2 {
+					h[extra[i]] = extra[i+1]
+				}
+
+				return h
+			}
+
+			assert.NoError(t, subscriber.Verify("v1.billing.charged", "1", withSignature(id, signature), payload))
+
+			// Signing again, e.g.: forwarding, ignores the previous signature.
+			reID, reSignature, err := publisher.Sign("v1.billing.charged", "1", withSignature(id, signature), payload)
+			assert.NoError(t, err)
+			assert.Equal(t, id, reID)
+			assert.Equal(t, signature, reSignature)
+
+			// Tampered.
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "1", withSignature(id, signature), []byte("refunded")))
+
+			// Tampered headers, changed, or added.
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "1", withSignature(id, signature, "tenant", "evil"), payload))
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "1", withSignature(id, signature, "role", "admin"), payload))
+
+			// Tampered ID.
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "2", withSignature(id, signature), payload))
+
+			// Replayed on another topic.
+			assert.Error(t, subscriber.Verify("v1.billing.refunded", "1", withSignature(id, signature), payload))
+
+			// Unsigned.
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "1", headers, payload))
+
+			// Untrusted key.
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "1", withSignature("unknown", signature), payload))
+
+			// Malformed signature.
+			assert.Error(t, subscriber.Verify("v1.billing.charged", "1", withSignature(id, "!"), payload))
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package subscription
+
+import (
+	"time"
+
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
+	"github.com/WreckingBallStudioLabs/pubsub/dedup"
+	"github.com/WreckingBallStudioLabs/pubsub/message"
+)
+
+//////
+// Vars, consts, and types.
+//////
+
+// Option allows to set subscription options.
+type Option func(s *Subscription) error
+
+//////
+// Exported built-in options.
+//////
+
+// WithTimeout bounds the message handling. Zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Subscription) error {
+		s.Timeout = timeout
+
+		return nil
+	}
+}
+
+// WithRetry retries failed handlings, in process, according to `policy`, e.g.:
+// `backoff.Exponential(3, 100*time.Millisecond)`.
+func WithRetry(policy *backoff.Policy) Option {
+	return func(s *Subscription) error {
+		s.Retry = policy
+
+		return nil
+	}
+}
+
+// WithManualAck leaves acknowledging messages to the handler, see
+// `message.Message.Ack`. By default, messages are acknowledged once handled
+// successfully.
+func WithManualAck() Option {
+	return func(s *Subscription) error {
+		s.AckMode = AckManual
+
+		return nil
+	}
+}
+
+// WithDedup skips messages which key, see `dedup.KeyFunc`, is recorded in
+// `store`, recording the keys of successfully handled messages, so redelivered
+// messages are handled effectively once. `key` defaults to `dedup.ByID`, use
+// `dedup.ByContent` to identify messages by content.
+func WithDedup(store dedup.Store, key dedup.KeyFunc) Option {
+	return func(s *Subscription) error {
+		if key == nil {
+			key = dedup.ByID
+		}
+
+		s.Dedup = store
+		s.DedupKey = key
+
+		return nil
+	}
+}
+
+// WithMiddleware wraps the message handling with `middlewares`, the first
+// being the outermost. They run after the pubsub ones.
+func WithMiddleware(middlewares ...HandlerMiddleware) Option {
+	return func(s *Subscription) error {
+		s.Middlewares = append(s.Middlewares, middlewares...)
+
+		return nil
+	}
+}
+
+// WithChannel also delivers successfully handled messages to
+// `Subscription.Channel`, holding up to `size` messages. `overflow` is what to
+// do when it's full.
+func WithChannel(size int, overflow OverflowPolicy) Option {
+	return func(s *Subscription) error {
+		if size < 0 {
+			size = 0
+		}
+
+		s.Channel = make(chan *message.Message, size)
+		s.Overflow = overflow
+
+		return nil
+	}
+}
+
+// WithDecodeErrorDrop logs, and drops messages which can't be decoded. It's
+// the default.
+func WithDecodeErrorDrop() Option {
+	return func(s *Subscription) error {
+		s.DecodeErrorPolicy = DecodeErrorDrop
+
+		return nil
+	}
+}
+
+// WithDecodeErrorHook calls `hook` with messages which can't be decoded.
+func WithDecodeErrorHook(hook DecodeErrorFunc) Option {
+	return func(s *Subscription) error {
+		s.DecodeErrorPolicy = DecodeErrorHook
+		s.OnDecodeError = hook
+
+		return nil
+	}
+}
+
+// WithPoisonTopic routes messages which can't be decoded, as is, to `topic`.
+// If `topic` is empty, it defaults to the subscription topic suffixed with
+// `DefaultPoisonTopicSuffix`.
+func WithPoisonTopic(topic string) Option {
+	return func(s *Subscription) error {
+		s.DecodeErrorPolicy = DecodeErrorPoison
+		s.PoisonTopic = topic
+
+		return nil
+	}
+}
+
+// WithDeadLetter routes messages which handling failed `maxAttempts` times to
+// `topic`, with the failure metadata: error, attempts, and failure time. If
+// `topic` is empty, it defaults to the subscription topic suffixed with
+// `DefaultDeadLetterTopicSuffix`. Pubsubs not redelivering messages retry
+// them in process: according to the retry policy, if any (see `WithRetry`),
+// otherwise immediately, up to `maxAttempts` times. Messages are routed as
+// received, e.g.: encrypted, so `topic` consumers need the same keys.
+func WithDeadLetter(maxAttempts int, topic string) Option {
+	return func(s *Subscription) error {
+		s.MaxAttempts = maxAttempts
+		s.DeadLetterTopic = topic
+
+		return nil
+	}
+}
+
+// WithPanicDeadLetter routes messages which handling panicked to `topic`. If
+// `topic` is empty, it defaults to the subscription topic suffixed with
+// `DefaultDeadLetterTopicSuffix`.
+func WithPanicDeadLetter(topic string) Option {
+	return func(s *Subscription) error {
+		s.PanicPolicy = PanicDeadLetter
+		s.DeadLetterTopic = topic
+
+		return nil
+	}
+}
+
+// WithPanicRedelivery delivers messages which handling panicked again, up to
+// `max` times. If `max` isn't positive, it defaults to
+// `DefaultMaxRedeliveries`.
+func WithPanicRedelivery(max int) Option {
+	return func(s *Subscription) error {
+		if max <= 0 {
+			max = DefaultMaxRedeliveries
+		}
+
+		s.PanicPolicy = PanicRedeliver
+		s.MaxRedeliveries = max
+
+		return nil
+	}
+}
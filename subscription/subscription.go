@@ -1,12 +1,17 @@
 package subscription
 
 import (
+	"context"
 	"time"
 
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
 	"github.com/WreckingBallStudioLabs/pubsub/common"
+	"github.com/WreckingBallStudioLabs/pubsub/dedup"
+	"github.com/WreckingBallStudioLabs/pubsub/errorcatalog"
 	"github.com/WreckingBallStudioLabs/pubsub/message"
 	"github.com/WreckingBallStudioLabs/pubsub/name"
 	"github.com/thalesfsp/configurer/util"
+	"github.com/thalesfsp/customerror"
 	"github.com/thalesfsp/status"
 )
 
@@ -17,6 +22,116 @@ import (
 // Func is the function to call when a message is received.
 type Func func(msg *message.Message)
 
+// HandlerFunc is the function to call when a message is received. `ctx`
+// carries the tracing information, and is done once the subscription timeout
+// is reached, or the subscription is stopped. Returning an error signals the
+// message processing failed.
+type HandlerFunc func(ctx context.Context, msg *message.Message) error
+
+// HandlerMiddleware wraps the message handling, e.g.: to authorize, enrich, or
+// redact messages, or to measure handlings. It calls `next` to continue.
+type HandlerMiddleware func(next HandlerFunc) HandlerFunc
+
+// DecodeFunc decodes, in place, the data of a received message. Failures are
+// handled according to the subscription decode error policy.
+type DecodeFunc func(msg *message.Message) error
+
+// TypedHandlerFunc is the function to call when a message is received, with
+// its data decoded into `T`. See `HandlerFunc`.
+type TypedHandlerFunc[T any] func(ctx context.Context, msg *message.Message, data T) error
+
+// DecodeErrorFunc is called with messages which can't be decoded: their raw
+// payload, headers, and the decoding error.
+type DecodeErrorFunc func(ctx context.Context, payload []byte, headers map[string]string, err error)
+
+// AckMode is how delivered messages are acknowledged, for pubsubs supporting
+// acknowledgements, e.g.: JetStream.
+type AckMode string
+
+// Ack modes.
+const (
+	// AckAuto acknowledges messages once handled successfully, otherwise
+	// signals they should be redelivered. Messages already acknowledged by the
+	// handler are left as is. Pulled messages are always acknowledged
+	// manually, see `Subscription.Next`.
+	AckAuto AckMode = "auto"
+
+	// AckManual leaves acknowledging messages to the handler, see
+	// `message.Message.Ack`. Unacknowledged messages are redelivered by the
+	// broker.
+	AckManual AckMode = "manual"
+)
+
+// DecodeErrorPolicy is what to do with messages which can't be decoded.
+type DecodeErrorPolicy string
+
+// Decode error policies.
+const (
+	// DecodeErrorDrop logs, and drops the message.
+	DecodeErrorDrop DecodeErrorPolicy = "drop"
+
+	// DecodeErrorHook calls the subscription `OnDecodeError` hook.
+	DecodeErrorHook DecodeErrorPolicy = "hook"
+
+	// DecodeErrorPoison routes the message, as is, to the subscription
+	// `PoisonTopic`.
+	DecodeErrorPoison DecodeErrorPolicy = "poison"
+)
+
+// DefaultPoisonTopicSuffix is appended to the topic to name the default poison
+// topic, e.g.: "v1.meta.created.poison".
+const DefaultPoisonTopicSuffix = ".poison"
+
+// OverflowPolicy is what to do when delivering to a full `Channel`.
+type OverflowPolicy string
+
+// Overflow policies.
+const (
+	// OverflowBlock waits for room in the channel, blocking the delivery.
+	OverflowBlock OverflowPolicy = "block"
+
+	// OverflowDropNewest drops the message being delivered.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+
+	// OverflowDropOldest drops the oldest message in the channel, making room
+	// for the message being delivered. Unbuffered channels hold nothing to
+	// drop, so the message being delivered is dropped instead.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+
+	// OverflowError drops the message being delivered, and reports it as an
+	// error.
+	OverflowError OverflowPolicy = "error"
+)
+
+// PanicPolicy is what to do with messages which handling panicked.
+type PanicPolicy string
+
+// Panic policies. Whatever the policy, panics are recovered, and the
+// subscription keeps receiving messages.
+const (
+	// PanicDeadLetter routes the message to the subscription `DeadLetterTopic`.
+	PanicDeadLetter PanicPolicy = "deadletter"
+
+	// PanicRecover reports, and drops the message.
+	PanicRecover PanicPolicy = "recover"
+
+	// PanicRedeliver delivers the message again, up to `MaxRedeliveries`
+	// times.
+	PanicRedeliver PanicPolicy = "redeliver"
+)
+
+// DefaultDeadLetterTopicSuffix is appended to the topic to name the default
+// dead letter topic, e.g.: "v1.meta.created.dlq".
+const DefaultDeadLetterTopicSuffix = ".dlq"
+
+// DefaultMaxRedeliveries is the default amount of times a message is
+// redelivered, see `PanicRedeliver`.
+const DefaultMaxRedeliveries = 3
+
+// NextFunc pulls the next message, blocking until one is received, or `ctx` is
+// done.
+type NextFunc func(ctx context.Context) (*message.Message, error)
+
 // Subscription is a subscription to a topic.
 type Subscription struct {
 	common.Common
@@ -25,8 +140,155 @@ type Subscription struct {
 	// message.
 	Func Func `json:"-"`
 
-	// Channel is the channel to receive messages.
+	// Handler is the function to call when a message is received. Unlike
+	// `Func`, it's context-aware, and can signal failures.
+	Handler HandlerFunc `json:"-"`
+
+	// Dedup records the keys of handled messages, so redelivered ones are
+	// skipped. Off if not set, see `WithDedup`.
+	Dedup dedup.Store `json:"-"`
+
+	// DedupKey identifies messages for `Dedup`. Defaults to `dedup.ByID`.
+	DedupKey dedup.KeyFunc `json:"-"`
+
+	// Middlewares wrap the message handling, after the pubsub ones, see
+	// `WithMiddleware`.
+	Middlewares []HandlerMiddleware `json:"-"`
+
+	// Timeout bounds the message handling. Zero means no timeout.
+	Timeout time.Duration `json:"timeout,omitempty" validate:"gte=0"`
+
+	// Retry is how failed handlings are retried, in process. Nil means no
+	// retries.
+	Retry *backoff.Policy `json:"retry,omitempty"`
+
+	// AckMode is how delivered messages are acknowledged.
+	AckMode AckMode `json:"ackMode,omitempty" default:"auto" validate:"oneof=auto manual"`
+
+	// Channel is the channel to receive messages. It's opt-in, see
+	// `WithChannel`. It's closed once unsubscribed.
 	Channel chan *message.Message `json:"-"`
+
+	// Decoder decodes, in place, the data of received messages, before
+	// handling them.
+	Decoder DecodeFunc `json:"-"`
+
+	// DecodeErrorPolicy is what to do with messages which can't be decoded.
+	DecodeErrorPolicy DecodeErrorPolicy `json:"decodeErrorPolicy,omitempty" default:"drop" validate:"oneof=drop hook poison"`
+
+	// OnDecodeError is called with messages which can't be decoded, if the
+	// policy is `DecodeErrorHook`.
+	OnDecodeError DecodeErrorFunc `json:"-"`
+
+	// DeadLetterTopic is where messages which handling failed `MaxAttempts`
+	// times, or panicked, if the policy is `PanicDeadLetter`, are routed to,
+	// with the failure metadata. Defaults to the topic suffixed with
+	// `DefaultDeadLetterTopicSuffix`.
+	DeadLetterTopic string `json:"deadLetterTopic,omitempty"`
+
+	// MaxAttempts is the amount of times the message handling is attempted
+	// before the message is routed to `DeadLetterTopic`. Zero means messages
+	// are never dead-lettered, failed handlings are only redelivered by
+	// pubsubs supporting it.
+	MaxAttempts int `json:"maxAttempts,omitempty" validate:"gte=0"`
+
+	// MaxRedeliveries is the amount of times a message is redelivered, if the
+	// policy is `PanicRedeliver`.
+	MaxRedeliveries int `json:"maxRedeliveries,omitempty" validate:"gte=0"`
+
+	// Overflow is what to do when delivering to a full `Channel`.
+	Overflow OverflowPolicy `json:"overflow,omitempty" default:"block" validate:"oneof=block drop-newest drop-oldest error"`
+
+	// PanicPolicy is what to do with messages which handling panicked.
+	PanicPolicy PanicPolicy `json:"panicPolicy,omitempty" default:"recover" validate:"oneof=deadletter recover redeliver"`
+
+	// PoisonTopic is where messages which can't be decoded are routed to, if
+	// the policy is `DecodeErrorPoison`. Defaults to the topic suffixed with
+	// `DefaultPoisonTopicSuffix`.
+	PoisonTopic string `json:"poisonTopic,omitempty"`
+
+	// next pulls messages. Only set for synchronous subscriptions.
+	next NextFunc
+}
+
+//////
+// Methods.
+//////
+
+// CanSubscribe fails if `s` was unsubscribed: its channel is closed, so it
+// can't be subscribed again. Create a new subscription instead.
+func (s *Subscription) CanSubscribe() error {
+	if s.Status != status.Stopped {
+		return nil
+	}
+
+	return errorcatalog.
+		Get().
+		MustGet(errorcatalog.PubSubErrSubscriptionUnsubscribed).
+		NewFailedToError(
+			customerror.WithField("topic", s.Topic),
+			customerror.WithField("id", s.ID),
+		)
+}
+
+// SetNext sets how to pull messages. It's set by the pubsub when subscribing
+// synchronously.
+func (s *Subscription) SetNext(next NextFunc) {
+	s.next = next
+}
+
+// Next pulls the next message, blocking until one is received, or `ctx` is
+// done. Only available for synchronous subscriptions, see `pubsub.WithSync`.
+//
+// Pulled messages are never acknowledged automatically, whatever the ack mode:
+// acknowledge them once handled, see `message.Message.Ack`, otherwise pubsubs
+// supporting acknowledgements, e.g.: JetStream, redeliver them.
+func (s *Subscription) Next(ctx context.Context) (*message.Message, error) {
+	if s.next == nil {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSubscriptionNotSync).
+			NewFailedToError(
+				customerror.WithField("topic", s.Topic),
+				customerror.WithField("id", s.ID),
+			)
+	}
+
+	return s.next(ctx)
+}
+
+// Fetch pulls up to `n` messages. It returns earlier, with what was pulled, if
+// `ctx` is done. It only fails if no message was pulled. Only available for
+// synchronous subscriptions, see `pubsub.WithSync`. Like `Next`, pulled
+// messages should be acknowledged. `n` should be positive.
+func (s *Subscription) Fetch(ctx context.Context, n int) ([]*message.Message, error) {
+	if n <= 0 {
+		return nil, errorcatalog.
+			Get().
+			MustGet(errorcatalog.PubSubErrSubscriptionFetchSize).
+			NewFailedToError(
+				customerror.WithField("topic", s.Topic),
+				customerror.WithField("id", s.ID),
+				customerror.WithField("n", n),
+			)
+	}
+
+	msgs := make([]*message.Message, 0, n)
+
+	for len(msgs) < n {
+		msg, err := s.Next(ctx)
+		if err != nil {
+			if len(msgs) > 0 {
+				break
+			}
+
+			return nil, err
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
 }
 
 //////
@@ -35,7 +297,7 @@ type Subscription struct {
 
 // New creates a new subscription. topic and queue should be in the form of the
 // following example: "v1.meta.created" and "v1.meta.created.queue".
-func New(topic, queue string, callback Func) (*Subscription, error) {
+func New(topic, queue string, callback Func, opts ...Option) (*Subscription, error) {
 	t, err := name.New(topic)
 	if err != nil {
 		return nil, err
@@ -54,20 +316,103 @@ func New(topic, queue string, callback Func) (*Subscription, error) {
 			Topic:     t.String(),
 		},
 
-		Func:    callback,
-		Channel: make(chan *message.Message),
+		Func: callback,
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := util.Process(s); err != nil {
 		return nil, err
 	}
 
+	if s.PoisonTopic == "" {
+		s.PoisonTopic = s.Topic + DefaultPoisonTopicSuffix
+	}
+
+	if s.DeadLetterTopic == "" {
+		s.DeadLetterTopic = s.Topic + DefaultDeadLetterTopicSuffix
+	}
+
 	return s, nil
 }
 
 // MustNew creates a new subscription, panicking if there's an error.
-func MustNew(topic, queue string, callback Func) *Subscription {
-	s, err := New(topic, queue, callback)
+func MustNew(topic, queue string, callback Func, opts ...Option) *Subscription {
+	s, err := New(topic, queue, callback, opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// NewWithHandler creates a new subscription which messages are handled by the
+// context-aware `handler`. topic and queue should be in the form of the
+// following example: "v1.meta.created" and "v1.meta.created.queue".
+func NewWithHandler(topic, queue string, handler HandlerFunc, opts ...Option) (*Subscription, error) {
+	s, err := New(topic, queue, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Handler = handler
+
+	return s, nil
+}
+
+// MustNewWithHandler creates a new subscription which messages are handled by
+// the context-aware `handler`, panicking if there's an error.
+func MustNewWithHandler(topic, queue string, handler HandlerFunc, opts ...Option) *Subscription {
+	s, err := NewWithHandler(topic, queue, handler, opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// NewTyped creates a new subscription which messages data are decoded into
+// `T`, then handled by `handler`. `Message.Data` also holds the decoded `T`.
+// Messages which can't be decoded are handled according to the subscription
+// decode error policy, not by `handler`. topic and queue should be in the form
+// of the following example: "v1.meta.created" and "v1.meta.created.queue".
+func NewTyped[T any](topic, queue string, handler TypedHandlerFunc[T], opts ...Option) (*Subscription, error) {
+	s, err := NewWithHandler(topic, queue, func(ctx context.Context, msg *message.Message) error {
+		data, _ := msg.Data.(T)
+
+		return handler(ctx, msg, data)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Decoder = func(msg *message.Message) error {
+		if _, ok := msg.Data.(T); ok {
+			return nil
+		}
+
+		var data T
+
+		if err := msg.Process(msg.Data, &data); err != nil {
+			return err
+		}
+
+		msg.Data = data
+
+		return nil
+	}
+
+	return s, nil
+}
+
+// MustNewTyped creates a new subscription which messages data are decoded into
+// `T`, then handled by `handler`, panicking if there's an error.
+func MustNewTyped[T any](topic, queue string, handler TypedHandlerFunc[T], opts ...Option) *Subscription {
+	s, err := NewTyped(topic, queue, handler, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -1,9 +1,11 @@
 package subscription
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/WreckingBallStudioLabs/pubsub/backoff"
 	"github.com/WreckingBallStudioLabs/pubsub/common"
 	"github.com/WreckingBallStudioLabs/pubsub/message"
 	"github.com/stretchr/testify/assert"
@@ -36,8 +38,7 @@ func TestNew(t *testing.T) {
 					Queue:     "v1.meta.created.queue",
 					Topic:     "v1.meta.created",
 				},
-				Func:    func(msg *message.Message) {},
-				Channel: make(chan *message.Message),
+				Func: func(msg *message.Message) {},
 			},
 		},
 	}
@@ -54,7 +55,138 @@ func TestNew(t *testing.T) {
 			assert.Equal(t, tt.args.topic, got.Topic)
 			assert.Equal(t, tt.args.queue, got.Queue)
 			assert.NotNil(t, tt.args.callback, got.Func)
-			assert.NotNil(t, got.Channel)
+			// Channel is opt-in.
+			assert.Nil(t, got.Channel)
+		})
+	}
+}
+
+func TestSubscription_Fetch(t *testing.T) {
+	s := MustNew("v1.meta.created", "v1.meta.created.queue", nil)
+
+	// Not synchronous.
+	_, err := s.Next(context.Background())
+	assert.Error(t, err)
+
+	pending := 2
+
+	s.SetNext(func(ctx context.Context) (*message.Message, error) {
+		if pending == 0 {
+			return nil, ctx.Err()
+		}
+
+		pending--
+
+		return message.MustNew(s.Topic, "data"), nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Returns what was pulled.
+	msgs, err := s.Fetch(ctx, 3)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+
+	// Fails if nothing was pulled.
+	_, err = s.Fetch(ctx, 3)
+	assert.Error(t, err)
+
+	// Fails if the amount isn't positive.
+	for _, n := range []int{0, -1} {
+		msgs, err := s.Fetch(context.Background(), n)
+		assert.Error(t, err)
+		assert.Nil(t, msgs)
+	}
+}
+
+func TestNewWithHandler(t *testing.T) {
+	got := MustNewWithHandler(
+		"v1.meta.created",
+		"v1.meta.created.queue",
+		func(ctx context.Context, msg *message.Message) error { return nil },
+		WithTimeout(time.Second),
+	)
+
+	assert.NotEmpty(t, got.ID)
+	assert.Nil(t, got.Func)
+	assert.NotNil(t, got.Handler)
+	assert.Equal(t, time.Second, got.Timeout)
+
+	// Invalid options fail.
+	_, err := NewWithHandler("v1.meta.created", "v1.meta.created.queue", nil, WithTimeout(-time.Second))
+	assert.Error(t, err)
+}
+
+func TestNewTyped(t *testing.T) {
+	type data struct {
+		Name string `json:"name"`
+	}
+
+	var got data
+
+	s := MustNewTyped(
+		"v1.meta.created",
+		"v1.meta.created.queue",
+		func(ctx context.Context, msg *message.Message, d data) error {
+			got = d
+
+			return nil
+		},
+	)
+
+	assert.NotNil(t, s.Handler)
+	assert.NotNil(t, s.Decoder)
+
+	// Decodes in place, as received, e.g.: from JSON.
+	msg := message.MustNew(s.Topic, map[string]any{"name": "test"})
+
+	assert.NoError(t, s.Decoder(msg))
+	assert.Equal(t, data{Name: "test"}, msg.Data)
+
+	assert.NoError(t, s.Handler(context.Background(), msg))
+	assert.Equal(t, data{Name: "test"}, got)
+
+	// Undecodable data fails.
+	assert.Error(t, s.Decoder(message.MustNew(s.Topic, "test")))
+}
+
+func TestWithRetry(t *testing.T) {
+	got := MustNew("v1.meta.created", "v1.meta.created.queue", nil, WithRetry(backoff.Jittered(3, time.Second, 0.5)))
+
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, got.Retry.Backoff)
+	assert.Equal(t, 0.5, got.Retry.Jitter)
+
+	_, err := New("v1.meta.created", "v1.meta.created.queue", nil, WithRetry(backoff.Jittered(3, time.Second, 2)))
+	assert.Error(t, err)
+}
+
+func TestWithChannel(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		overflow OverflowPolicy
+	}{
+		{
+			name:     "Should work - buffered, drop-oldest",
+			size:     2,
+			overflow: OverflowDropOldest,
+		},
+		{
+			name:     "Should work - unbuffered, drop-newest",
+			overflow: OverflowDropNewest,
+		},
+		{
+			name:     "Should work - unbuffered, drop-oldest",
+			overflow: OverflowDropOldest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New("v1.meta.created", "v1.meta.created.queue", nil, WithChannel(tt.size, tt.overflow))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.size, cap(got.Channel))
+			assert.Equal(t, tt.overflow, got.Overflow)
 		})
 	}
 }